@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Действия, которые попадают в журнал изменений
+const (
+	AuditCreate   = "create"
+	AuditUpdate   = "update"
+	AuditDelete   = "delete"
+	AuditDone     = "done"
+	AuditUndone   = "undone"
+	AuditRevert   = "revert"
+	AuditSchedule = "schedule"
+)
+
+// AuditEntry - запись журнала изменений задачи
+type AuditEntry struct {
+	ID        string                `json:"id"`
+	CreatedAt string                `json:"created_at"`
+	Actor     string                `json:"actor"`
+	IP        string                `json:"ip"`
+	Action    string                `json:"action"`
+	TaskID    string                `json:"task_id"`
+	Before    *Task                 `json:"before"`
+	After     *Task                 `json:"after"`
+	Diff      map[string]AuditField `json:"diff"`
+}
+
+// AuditField - значение поля до и после изменения
+type AuditField struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// writeAudit - сохраняет запись об изменении задачи в той же транзакции, что и само изменение.
+// taskID - целый ключ задачи, before и after - состояние задачи до и после изменения (nil, если задачи не было).
+func writeAudit(q dbtx, r *http.Request, action, taskID string, before, after *Task) error {
+	actor := actorFromContext(r.Context())
+	if actor == "" {
+		actor = "anonymous"
+	}
+	var taskUID sql.NullString
+	for _, task := range []*Task{after, before} {
+		if task != nil && isULID(task.ID) {
+			taskUID = sql.NullString{String: task.ID, Valid: true}
+			break
+		}
+	}
+
+	_, err := q.ExecContext(r.Context(), `INSERT INTO audit_log (created_at, actor, ip, action, task_id, task_uid, before, after)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		dbTime(time.Now()), actor, clientIP(r), action, taskID, taskUID,
+		auditSnapshot(before), auditSnapshot(after))
+	if err != nil {
+		log.Printf("writeAudit: ошибка записи журнала action=%s id=%s: %v\n", action, taskID, err)
+	}
+	return err
+}
+
+// auditSnapshot - сериализует состояние задачи для журнала
+func auditSnapshot(task *Task) sql.NullString {
+	if task == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return sql.NullString{}
+	}
+	// В копии задачи есть комментарий, поэтому при включённом шифровании шифруем её целиком
+	value, err := encryptField(string(data))
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: value, Valid: true}
+}
+
+// parseSnapshot - восстанавливает состояние задачи из журнала
+func parseSnapshot(data sql.NullString) (*Task, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	plain, err := decryptField(data.String)
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(plain), &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// auditDiff - возвращает поля, которые отличаются до и после изменения
+func auditDiff(before, after *Task) map[string]AuditField {
+	toMap := func(task *Task) map[string]interface{} {
+		m := map[string]interface{}{}
+		if task == nil {
+			return m
+		}
+		data, _ := json.Marshal(task)
+		json.Unmarshal(data, &m)
+		return m
+	}
+	b, a := toMap(before), toMap(after)
+
+	diff := map[string]AuditField{}
+	for key, value := range b {
+		// Значения из JSON бывают объектами и массивами, их != не сравнит
+		if !reflect.DeepEqual(a[key], value) {
+			diff[key] = AuditField{Before: value, After: a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok {
+			diff[key] = AuditField{Before: nil, After: value}
+		}
+	}
+	return diff
+}
+
+// clientIP - адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditHandler - возвращает журнал изменений с фильтрами
+// task_id, actor, action, from и to (даты в формате 20060102) и limit.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	q := r.URL.Query()
+	var where []string
+	var args []interface{}
+
+	// task_id принимает и ULID, и прежний целый ID
+	if v := q.Get("task_id"); v != "" {
+		where = append(where, "(task_uid = ? OR task_id = ?)")
+		args = append(args, v, v)
+	}
+	for _, f := range []struct{ param, column string }{
+		{"actor", "actor"},
+		{"action", "action"},
+	} {
+		if v := q.Get(f.param); v != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, v)
+		}
+	}
+
+	if v := q.Get("from"); v != "" {
+		from, err := time.ParseInLocation("20060102", v, time.Local)
+		if err != nil {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "from").text(CodeInvalidParam+".date"))
+			return
+		}
+		where = append(where, "created_at >= ?")
+		args = append(args, dbTime(from))
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := time.ParseInLocation("20060102", v, time.Local)
+		if err != nil {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "to").text(CodeInvalidParam+".date"))
+			return
+		}
+		// Граница включительно: всё, что раньше начала следующего дня
+		where = append(where, "created_at < ?")
+		args = append(args, dbTime(to.AddDate(0, 0, 1)))
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "limit"))
+			return
+		}
+		limit = n
+	}
+
+	query := "SELECT id, created_at, actor, ip, action, COALESCE(task_uid, task_id), before, after FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		log.Printf("auditHandler: ошибка запроса: %v\n", err)
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.IP, &e.Action, &e.TaskID, &before, &after); err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		if e.Before, err = parseSnapshot(before); err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		if e.After, err = parseSnapshot(after); err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		e.Diff = auditDiff(e.Before, e.After)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"audit": entries})
+}
+
+// auditRevertHandler - откатывает задачу к состоянию до указанной записи журнала
+func auditRevertHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+
+	var taskID string
+	var taskUID, snapshot sql.NullString
+	err := db.QueryRowContext(r.Context(), "SELECT task_id, task_uid, before FROM audit_log WHERE id = ?", id).
+		Scan(&taskID, &taskUID, &snapshot)
+	if err == sql.ErrNoRows {
+		writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeAuditNotFound))
+		return
+	} else if err != nil {
+		log.Printf("auditRevertHandler: ошибка запроса id=%s: %v\n", id, err)
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+
+	target, err := parseSnapshot(snapshot)
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+	if target == nil {
+		// До создания задачи откатывать не к чему - для этого есть удаление
+		writeAPIError(w, r, newAPIError(http.StatusConflict, CodeCannotRevert))
+		return
+	}
+
+	stored := *target
+	if err := encryptTask(&stored); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeEncryption))
+		return
+	}
+	completedAt := sql.NullString{String: target.CompletedAt, Valid: target.CompletedAt != ""}
+	if t, err := time.Parse(time.RFC3339, target.CompletedAt); err == nil {
+		// В старых записях журнала время с местным поясом
+		completedAt.String = dbTime(t)
+	}
+
+	var after *Task
+	ctx := r.Context()
+	err = withTx(ctx, func(tx *sql.Tx) error {
+		current, err := loadTask(ctx, tx, taskID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if current == nil {
+			// Задача в архиве: вставка вернула бы её в scheduler, не убрав из архива
+			var archived int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM archive WHERE id = ?", taskID).Scan(&archived); err != nil {
+				return err
+			}
+			if archived > 0 {
+				return newAPIError(http.StatusConflict, CodeTaskArchived)
+			}
+		}
+
+		// If-Match проверяется так же, как в PUT и DELETE; у удалённой задачи версии нет,
+		// поэтому с ней не совпадает ни одно значение
+		if current == nil && r.Header.Get("If-Match") != "" || current != nil && !ifMatch(r, current.Version) {
+			return newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
+		}
+
+		if current != nil {
+			_, err = tx.ExecContext(ctx, `UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ?, status = ?, completed_at = ?,
+				version = version + 1 WHERE id = ?`,
+				target.Date, stored.Title, stored.Comment, target.Repeat, target.Status, completedAt, taskID)
+		} else {
+			// Задача была удалена - возвращаем её под тем же ключом и ULID с версией новее сохранённой
+			if !taskUID.Valid {
+				taskUID = sql.NullString{String: newULID(time.Now()), Valid: true}
+			}
+			version, _ := strconv.Atoi(target.Version)
+			_, err = tx.ExecContext(ctx, `INSERT INTO scheduler (id, uid, date, title, comment, repeat, status, completed_at, version)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				taskID, taskUID, target.Date, stored.Title, stored.Comment, target.Repeat, target.Status, completedAt, version+1)
+		}
+		if err != nil {
+			log.Printf("auditRevertHandler: ошибка восстановления задачи id=%s: %v\n", taskID, err)
+			return err
+		}
+
+		if after, err = loadTask(ctx, tx, taskID); err != nil {
+			return err
+		}
+		return writeAudit(tx, r, AuditRevert, taskID, current, after)
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(after.Version))
+	json.NewEncoder(w).Encode(after)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := &Task{ID: "1", Date: "20990101", Title: "Полить цветы", Repeat: "d 3",
+		RepeatRule: &RepeatRule{Kind: "d", Interval: 3}}
+	after := &Task{ID: "1", Date: "20990101", Title: "Полить цветы", Repeat: "d 7",
+		RepeatRule: &RepeatRule{Kind: "d", Interval: 7}}
+
+	// Правило в JSON - объект, сравнение не должно на нём падать
+	diff := auditDiff(before, after)
+	assert.Equal(t, "d 3", diff["repeat"].Before)
+	assert.Equal(t, "d 7", diff["repeat"].After)
+	assert.Equal(t, map[string]any{"kind": "d", "interval": 3.0}, diff["repeat_rule"].Before)
+	assert.NotContains(t, diff, "title")
+
+	assert.Empty(t, auditDiff(before, before))
+	assert.Contains(t, auditDiff(nil, after), "repeat_rule")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -13,12 +14,27 @@ import (
 
 // Claims - структура для данных в токене
 type Claims struct {
-	PasswordHash         string `json:"password_hash"` // Хэш пароля для проверки
+	PasswordHash         string `json:"password_hash"`  // Хэш пароля для проверки
+	Lang                 string `json:"lang,omitempty"` // Язык сообщений, выбранный при входе
 	jwt.RegisteredClaims        // Стандартные поля JWT
 }
 
-// authMiddleware - проверяет токен перед выполнением запроса
+// contextKey - тип ключей для значений в контексте запроса
+type contextKey string
+
+// actorKey - ключ для имени пользователя из токена
+const actorKey contextKey = "actor"
+
+// actorFromContext - возвращает имя пользователя, сделавшего запрос
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// authMiddleware - проверяет токен перед выполнением запроса.
+// После токена запрос проверяется по описанию API (withValidation).
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	next = withValidation(next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Смотрим наличие пароля
 		pass := os.Getenv("TODO_PASSWORD")
@@ -48,13 +64,17 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 					hash := fmt.Sprintf("%x", sha256.Sum256([]byte(pass)))
 					if claims.PasswordHash == hash {
 						valid = true // Токен валиден, если хэш совпадает
+						// Запоминаем, кто делает запрос, для журнала изменений
+						ctx := context.WithValue(r.Context(), actorKey, claims.Subject)
+						// Выбранный при входе язык важнее Accept-Language
+						r = r.WithContext(withLang(ctx, claims.Lang))
 					}
 				}
 			}
 
 			if !valid {
 				// Возвращаем ошибку авторизации 401
-				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				writeAPIError(w, r, newAPIError(http.StatusUnauthorized, CodeAuthRequired))
 				return
 			}
 		}
@@ -70,24 +90,31 @@ func signinHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Проверяем метод
 	if r.Method != "POST" {
-		http.Error(w, `{"error":"Только POST"}`, http.StatusMethodNotAllowed)
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
 		return
 	}
 
-	// Структура для пароля из запроса
+	// Структура для пароля и имени пользователя из запроса
 	var input struct {
 		Password string `json:"password"`
+		Name     string `json:"name"` // Необязательное имя для журнала изменений
+		Lang     string `json:"lang"` // Необязательный язык сообщений: ru или en
 	}
 	// Читаем тело запроса
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, `{"error":"Ошибка в JSON"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
+		return
+	}
+
+	if input.Lang != "" && !supportedLang(input.Lang) {
+		writeAPIError(w, r, newFieldError(CodeInvalidField, "lang"))
 		return
 	}
 
 	// Сравниваем пароли
 	pass := os.Getenv("TODO_PASSWORD")
 	if pass == "" || input.Password != pass {
-		http.Error(w, `{"error":"Неправильный пароль"}`, http.StatusUnauthorized)
+		writeAPIError(w, r, newAPIError(http.StatusUnauthorized, CodeInvalidPassword))
 		return
 	}
 
@@ -97,7 +124,9 @@ func signinHandler(w http.ResponseWriter, r *http.Request) {
 	// Создаём токен
 	claims := &Claims{
 		PasswordHash: hash,
+		Lang:         input.Lang,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   input.Name,                                         // Кто вошёл
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Токен на 24 часа
 			IssuedAt:  jwt.NewNumericDate(time.Now()),                     // Время создания
 		},
@@ -106,7 +135,7 @@ func signinHandler(w http.ResponseWriter, r *http.Request) {
 	secretKey := "my_secret_key"
 	tokenStr, err := token.SignedString([]byte(secretKey))
 	if err != nil {
-		http.Error(w, `{"error":"Не могу создать токен"}`, http.StatusInternalServerError)
+		writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeInternal).text(CodeInternal+".token"))
 		return
 	}
 
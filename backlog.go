@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// scheduleTaskHandler - переносит задачу из бэклога на дату.
+// POST /api/task/schedule?id=<id>&date=20060102, без date задача ставится на сегодня.
+func scheduleTaskHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+	date := r.URL.Query().Get("date")
+
+	ctx := r.Context()
+	var after *Task
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		before, err := loadTask(ctx, tx, id)
+		if err == sql.ErrNoRows {
+			return newAPIError(http.StatusNotFound, CodeTaskNotFound)
+		} else if err != nil {
+			return err
+		}
+		if before.Date != "" {
+			return newAPIError(http.StatusConflict, CodeAlreadyScheduled)
+		}
+		if !ifMatch(r, before.Version) {
+			return newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
+		}
+
+		// Дата проверяется так же, как при создании задачи
+		task := *before
+		task.Date, task.Backlog = date, false
+		if err := validateTask(&task, time.Now()); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE scheduler SET date = ?, version = version + 1 WHERE id = ?", task.Date, before.Key)
+		if err != nil {
+			return err
+		}
+		if after, err = loadTask(ctx, tx, before.Key); err != nil {
+			return err
+		}
+		return writeAudit(tx, r, AuditSchedule, before.Key, before, after)
+	})
+	if err != nil {
+		log.Printf("scheduleTaskHandler: задача id=%s не запланирована: %v\n", id, err)
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(after.Version))
+	json.NewEncoder(w).Encode(after)
+}
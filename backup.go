@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBackupInterval = 24 * time.Hour // Как часто делать снимки по умолчанию
+	defaultBackupKeep     = 7              // Сколько последних снимков хранить
+	backupPrefix          = "scheduler-"   // Начало имени файла снимка
+	backupExt             = ".db"          // Расширение файла снимка
+)
+
+// snapshotDB - сохраняет согласованную копию базы в файл path.
+// VACUUM INTO работает внутри одной транзакции чтения, поэтому копия не зависит от параллельных записей.
+func snapshotDB(ctx context.Context, path string) error {
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("снимок базы в %s: %w", path, err)
+	}
+	return nil
+}
+
+// backupHandler - отдаёт снимок базы для скачивания
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "scheduler-backup")
+	if err != nil {
+		log.Printf("backupHandler: не могу создать временную папку: %v\n", err)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeBackup))
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := backupFileName(time.Now())
+	path := filepath.Join(dir, name)
+	if err := snapshotDB(r.Context(), path); err != nil {
+		log.Printf("backupHandler: %v\n", err)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		writeError(w, r, err, CodeBackup)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("backupHandler: не могу открыть снимок: %v\n", err)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeBackup))
+		return
+	}
+	defer f.Close()
+
+	// Срок записи ответа (TODO_WRITE_TIMEOUT) рассчитан на обычные ответы,
+	// снимок отдаём без него, пока клиент сам не отключится
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("backupHandler: не могу снять срок записи: %v\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("backupHandler: ошибка отправки снимка: %v\n", err)
+	}
+}
+
+// backupFileName - имя файла снимка, сортируется по времени создания
+func backupFileName(t time.Time) string {
+	return backupPrefix + t.Format("20060102-150405") + backupExt
+}
+
+// runBackups - по расписанию делает снимки базы в папку dir и оставляет только keep последних.
+// Работает, пока не отменён ctx.
+func runBackups(ctx context.Context, dir string, interval time.Duration, keep int) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("runBackups: не могу создать папку %s: %v\n", dir, err)
+		return
+	}
+	log.Printf("runBackups: снимки каждые %v в %s, храним %d\n", interval, dir, keep)
+
+	// Первый снимок делаем сразу: сервер могут перезапускать чаще, чем раз в interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		path := filepath.Join(dir, backupFileName(time.Now()))
+		if err := snapshotDB(ctx, path); err != nil {
+			log.Printf("runBackups: %v\n", err)
+		} else {
+			log.Printf("runBackups: сохранён снимок %s\n", path)
+			if err := rotateBackups(dir, keep); err != nil {
+				log.Printf("runBackups: ошибка удаления старых снимков: %v\n", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotateBackups - удаляет из dir все снимки, кроме keep самых новых
+func rotateBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), backupExt) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return nil
+	}
+
+	// Имена содержат время, поэтому сортировка по имени - это сортировка по возрасту
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBackup - заменяет файл базы dbFile снимком из src.
+// Сервер при этом должен быть остановлен.
+func restoreBackup(src, dbFile string) error {
+	// Проверяем, что снимок - целая база SQLite
+	snap, err := sql.Open("sqlite3", "file:"+src+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	var result string
+	err = snap.QueryRow("PRAGMA integrity_check").Scan(&result)
+	snap.Close()
+	if err != nil {
+		return fmt.Errorf("снимок %s не читается: %w", src, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("снимок %s повреждён: %s", src, result)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Пишем во временный файл рядом с базой и подменяем одним переименованием
+	tmp := dbFile + ".restore"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Переносим в старую базу всё из её журнала WAL: если подмена не удастся,
+	// база останется целой вместе с последними изменениями. Испорченную базу,
+	// которую как раз и восстанавливают, это не остановит.
+	if _, err := os.Stat(dbFile); err == nil {
+		if old, err := sql.Open("sqlite3", "file:"+dbFile); err == nil {
+			if _, err := old.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+				log.Printf("restoreBackup: журнал базы %s не перенесён: %v\n", dbFile, err)
+			}
+			old.Close()
+		}
+	}
+
+	if err := os.Rename(tmp, dbFile); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Журналы старой базы к новому файлу не относятся
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbFile + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countTasks - сколько задач в файле базы path
+func countTasks(t *testing.T, path string) int {
+	t.Helper()
+	snap, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	require.NoError(t, err)
+	defer snap.Close()
+	var n int
+	require.NoError(t, snap.QueryRow("SELECT COUNT(*) FROM scheduler").Scan(&n))
+	return n
+}
+
+func TestBackupHandler(t *testing.T) {
+	openTestDB(t)
+	_, err := db.Exec("INSERT INTO scheduler (date, title) VALUES ('20990101', 'В снимке')")
+	require.NoError(t, err)
+
+	rec := serve(t, http.HandlerFunc(backupHandler), http.MethodGet, "/api/admin/backup", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/vnd.sqlite3", rec.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="scheduler-\d{8}-\d{6}\.db"$`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "SQLite format 3\x00"))
+
+	path := filepath.Join(t.TempDir(), "download.db")
+	require.NoError(t, os.WriteFile(path, rec.Body.Bytes(), 0o644))
+	assert.Equal(t, 1, countTasks(t, path))
+
+	rec = serve(t, http.HandlerFunc(backupHandler), http.MethodPost, "/api/admin/backup", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"scheduler-20250101-030000.db",
+		"scheduler-20250103-030000.db",
+		"scheduler-20250102-030000.db",
+		"scheduler-20250104-030000.db",
+		"notes.txt",
+	}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	require.NoError(t, rotateBackups(dir, 2))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	assert.Equal(t, []string{"notes.txt", "scheduler-20250103-030000.db", "scheduler-20250104-030000.db"}, left)
+}
+
+func TestRunBackups(t *testing.T) {
+	openTestDB(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	// Первый снимок появляется сразу, а не через interval
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runBackups(ctx, dir, time.Hour, 3)
+		close(done)
+	}()
+	var snapshots []string
+	for i := 0; i < 100 && len(snapshots) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		snapshots, _ = filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupExt))
+	}
+	cancel()
+	<-done
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, 0, countTasks(t, snapshots[0]))
+}
+
+func TestRestoreBackup(t *testing.T) {
+	dbFile := openTestDB(t)
+	_, err := db.Exec("INSERT INTO scheduler (date, title) VALUES ('20990101', 'До снимка')")
+	require.NoError(t, err)
+	snap := filepath.Join(t.TempDir(), backupFileName(time.Now()))
+	require.NoError(t, snapshotDB(context.Background(), snap))
+	_, err = db.Exec("INSERT INTO scheduler (date, title) VALUES ('20990102', 'После снимка')")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Испорченный снимок не трогает базу
+	broken := filepath.Join(t.TempDir(), "broken.db")
+	require.NoError(t, os.WriteFile(broken, []byte("не база"), 0o644))
+	assert.Error(t, restoreBackup(broken, dbFile))
+	assert.Equal(t, 2, countTasks(t, dbFile))
+
+	// Журналы старой базы удаляются после подмены файла
+	require.NoError(t, os.WriteFile(dbFile+"-wal", []byte("чужой журнал"), 0o644))
+	require.NoError(t, restoreBackup(snap, dbFile))
+	for _, suffix := range []string{"-wal", "-shm", "-journal", ".restore"} {
+		_, err := os.Stat(dbFile + suffix)
+		assert.True(t, os.IsNotExist(err), suffix)
+	}
+	assert.Equal(t, 1, countTasks(t, dbFile))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxBatchSize - больше операций за один запрос не принимаем
+const maxBatchSize = 500
+
+// Виды операций в пакете
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+	BatchDone   = "done"
+)
+
+// batchOperation - одна операция пакета.
+// Для create и update задача передаётся в task так же, как в POST и PUT /api/task,
+// для delete и done - только id. version работает как If-Match: операция выполнится,
+// только если задача не менялась.
+type batchOperation struct {
+	Op      string    `json:"op"`
+	ID      string    `json:"id,omitempty"`
+	Version string    `json:"version,omitempty"`
+	Task    taskInput `json:"task"`
+}
+
+// batchRequest - тело POST /api/tasks/batch.
+// Atomic по умолчанию true: все операции выполняются в одной транзакции,
+// и если одна не прошла, не применяется ни одна.
+type batchRequest struct {
+	Atomic     *bool            `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchResult - итог одной операции: ID и новая версия задачи или ошибка
+type batchResult struct {
+	Op      string     `json:"op"`
+	ID      string     `json:"id,omitempty"`
+	Version string     `json:"version,omitempty"`
+	Status  int        `json:"status"`
+	Error   *errorBody `json:"error,omitempty"`
+}
+
+// batchHandler - выполняет пакет операций над задачами.
+// В атомарном режиме ошибка любой операции отменяет весь пакет и отдаётся с её кодом,
+// в неатомарном (atomic: false) каждая операция идёт в своей транзакции,
+// а результат каждой возвращается в results.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeAPIError(w, r, newFieldError(CodeInvalidBatch, "operations"))
+		return
+	}
+	if len(req.Operations) > maxBatchSize {
+		writeAPIError(w, r, newFieldError(CodeInvalidBatch, "operations").text(CodeInvalidBatch+".size", maxBatchSize))
+		return
+	}
+	atomic := req.Atomic == nil || *req.Atomic
+
+	results := make([]batchResult, len(req.Operations))
+	if atomic {
+		err := withTx(r.Context(), func(tx *sql.Tx) error {
+			for i, op := range req.Operations {
+				result, err := applyBatchOperation(tx, r, op)
+				if err != nil {
+					// Номер операции помогает найти ошибку в большом пакете
+					var e *apiError
+					if errors.As(err, &e) {
+						opErr := *e
+						opErr.details = map[string]any{"operation": i}
+						return &opErr
+					}
+					return err
+				}
+				results[i] = result
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("batchHandler: пакет из %d операций отменён: %v\n", len(req.Operations), err)
+			writeError(w, r, err, CodeStorage+".batch")
+			return
+		}
+	} else {
+		for i, op := range req.Operations {
+			err := withTx(r.Context(), func(tx *sql.Tx) error {
+				var err error
+				results[i], err = applyBatchOperation(tx, r, op)
+				return err
+			})
+			if err != nil {
+				status, body := errorStatus(err, CodeStorage, requestLang(r))
+				results[i] = batchResult{Op: op.Op, ID: op.ID, Status: status, Error: &body}
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string][]batchResult{"results": results})
+}
+
+// applyBatchOperation - выполняет одну операцию пакета внутри транзакции.
+// Проверки и запись те же, что у отдельных запросов к /api/task и /api/task/done.
+func applyBatchOperation(tx *sql.Tx, r *http.Request, op batchOperation) (batchResult, error) {
+	result := batchResult{Op: op.Op, ID: op.ID, Status: http.StatusOK}
+	var after *Task
+	var err error
+	switch op.Op {
+	case BatchCreate:
+		after, err = insertTask(tx, r, op.Task, time.Now())
+		result.Status = http.StatusCreated
+	case BatchUpdate:
+		if op.ID != "" {
+			op.Task.ID = op.ID
+		}
+		after, err = replaceTask(tx, r, op.Task, versionMatch(op.Version))
+	case BatchDelete, BatchDone:
+		if op.ID == "" {
+			return result, newFieldError(CodeIDRequired, "id")
+		}
+		if op.Op == BatchDelete {
+			err = removeTask(tx, r, op.ID, versionMatch(op.Version))
+		} else {
+			after, err = completeTask(tx, r, op.ID, versionMatch(op.Version))
+		}
+	default:
+		return result, newFieldError(CodeInvalidBatch, "op").text(CodeInvalidBatch+".op", op.Op)
+	}
+	if err != nil {
+		return result, err
+	}
+	if after != nil {
+		result.ID, result.Version = after.ID, after.Version
+	}
+	return result, nil
+}
+
+// versionMatch - версия из операции в формате If-Match
+func versionMatch(version string) string {
+	if version == "" {
+		return ""
+	}
+	return taskETag(version)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// encPrefix - начало зашифрованного значения: "enc:v1:<id ключа>:<base64(nonce+шифротекст)>".
+// Значения без префикса считаются открытым текстом, поэтому старые записи читаются как раньше.
+const encPrefix = "enc:v1:"
+
+// plainPrefix - метка открытого текста, который сам начинается с "enc:".
+// Без неё введённое пользователем "enc:v1:..." читалось бы как шифротекст.
+const plainPrefix = "enc:plain:"
+
+// fieldCipher - ключ AES-256-GCM для шифрования полей задачи
+type fieldCipher struct {
+	id   string // Короткий отпечаток ключа, по нему выбирается ключ при расшифровке
+	aead cipher.AEAD
+}
+
+var (
+	fieldKey     *fieldCipher   // Текущий ключ; nil, если шифрование выключено
+	oldFieldKeys []*fieldCipher // Прежние ключи, которыми ещё можно расшифровать данные
+	encryptTitle bool           // Шифровать ли заголовок вместе с комментарием
+)
+
+// errUnknownKey - значение зашифровано ключом, которого нет
+var errUnknownKey = errors.New("значение зашифровано неизвестным ключом")
+
+// newFieldCipher - создаёт ключ из строки. Ключ AES получается как SHA-256 от строки,
+// поэтому подходит любая длинная случайная строка.
+func newFieldCipher(secret string) (*fieldCipher, error) {
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(sum[:])
+	return &fieldCipher{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+// initEncryption - включает шифрование, если задан TODO_ENCRYPTION_KEY.
+// TODO_ENCRYPTION_OLD_KEYS - прежние ключи через запятую, нужны для смены ключа.
+// TODO_ENCRYPT_TITLE=1 - шифровать ещё и заголовок.
+func initEncryption() error {
+	secret := os.Getenv("TODO_ENCRYPTION_KEY")
+	if secret == "" {
+		return nil
+	}
+
+	var err error
+	if fieldKey, err = newFieldCipher(secret); err != nil {
+		return err
+	}
+	for _, old := range strings.Split(os.Getenv("TODO_ENCRYPTION_OLD_KEYS"), ",") {
+		if old = strings.TrimSpace(old); old == "" {
+			continue
+		}
+		c, err := newFieldCipher(old)
+		if err != nil {
+			return err
+		}
+		oldFieldKeys = append(oldFieldKeys, c)
+	}
+	encryptTitle = os.Getenv("TODO_ENCRYPT_TITLE") == "1"
+
+	log.Printf("initEncryption: шифрование включено, ключ %s, заголовок шифруется: %v\n", fieldKey.id, encryptTitle)
+	return nil
+}
+
+// encryptionEnabled - шифруются ли поля задач
+func encryptionEnabled() bool {
+	return fieldKey != nil
+}
+
+// escapeField - помечает открытый текст, похожий на зашифрованное значение
+func escapeField(plain string) string {
+	if strings.HasPrefix(plain, "enc:") {
+		return plainPrefix + plain
+	}
+	return plain
+}
+
+// encryptField - шифрует значение текущим ключом. Пустые строки не шифруются.
+func encryptField(plain string) (string, error) {
+	if fieldKey == nil || plain == "" {
+		return escapeField(plain), nil
+	}
+	nonce := make([]byte, fieldKey.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := fieldKey.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encPrefix + fieldKey.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField - расшифровывает значение, если оно зашифровано
+func decryptField(value string) (string, error) {
+	if strings.HasPrefix(value, plainPrefix) {
+		return strings.TrimPrefix(value, plainPrefix), nil
+	}
+	if !strings.HasPrefix(value, encPrefix) {
+		return value, nil
+	}
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, encPrefix), ":")
+	if !ok {
+		return "", errors.New("повреждённое зашифрованное значение")
+	}
+
+	var key *fieldCipher
+	for _, c := range append([]*fieldCipher{fieldKey}, oldFieldKeys...) {
+		if c != nil && c.id == id {
+			key = c
+			break
+		}
+	}
+	if key == nil {
+		return "", fmt.Errorf("%w: %s", errUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < key.aead.NonceSize() {
+		return "", errors.New("повреждённое зашифрованное значение")
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plain, err := key.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// encryptTask - шифрует поля задачи перед записью в базу
+func encryptTask(task *Task) error {
+	var err error
+	if task.Comment, err = encryptField(task.Comment); err != nil {
+		return err
+	}
+	if !encryptTitle {
+		task.Title = escapeField(task.Title)
+		return nil
+	}
+	task.Title, err = encryptField(task.Title)
+	return err
+}
+
+// decryptTask - расшифровывает поля задачи после чтения из базы
+func decryptTask(task *Task) error {
+	var err error
+	if task.Comment, err = decryptField(task.Comment); err != nil {
+		return err
+	}
+	if task.Title, err = decryptField(task.Title); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rotateEncryptionKey - перешифровывает все задачи, архив, журнал изменений
+// и сохранённые ответы на запросы с Idempotency-Key текущим ключом.
+// Открытые значения тоже шифруются, так что команда подходит и для первого включения шифрования.
+func rotateEncryptionKey() error {
+	if fieldKey == nil {
+		return errors.New("не задан TODO_ENCRYPTION_KEY")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Сначала читаем всё, потом пишем: SQLite не любит запись в таблицу во время обхода
+	type row struct{ id, title, comment string }
+	var count int
+	for _, table := range []string{"scheduler", "archive"} {
+		var tasks []row
+		rows, err := tx.Query("SELECT id, title, COALESCE(comment, '') FROM " + table)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.title, &r.comment); err != nil {
+				rows.Close()
+				return err
+			}
+			tasks = append(tasks, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range tasks {
+			task := Task{Title: r.title, Comment: r.comment}
+			if err := decryptTask(&task); err != nil {
+				return fmt.Errorf("задача id=%s в %s: %w", r.id, table, err)
+			}
+			if err := encryptTask(&task); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE "+table+" SET title = ?, comment = ? WHERE id = ?", task.Title, task.Comment, r.id); err != nil {
+				return err
+			}
+		}
+		count += len(tasks)
+	}
+
+	// В журнале изменений лежат полные копии задач, их тоже перешифровываем
+	type snap struct {
+		id            string
+		before, after sql.NullString
+	}
+	var snaps []snap
+	rows, err := tx.Query("SELECT id, before, after FROM audit_log")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s snap
+		if err := rows.Scan(&s.id, &s.before, &s.after); err != nil {
+			rows.Close()
+			return err
+		}
+		snaps = append(snaps, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range snaps {
+		for _, v := range []*sql.NullString{&s.before, &s.after} {
+			if !v.Valid {
+				continue
+			}
+			plain, err := decryptField(v.String)
+			if err != nil {
+				return fmt.Errorf("запись журнала id=%s: %w", s.id, err)
+			}
+			if v.String, err = encryptField(plain); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("UPDATE audit_log SET before = ?, after = ? WHERE id = ?", s.before, s.after, s.id); err != nil {
+			return err
+		}
+	}
+
+	// Сохранённые ответы на запросы с Idempotency-Key тоже могут содержать задачу
+	type stored struct{ key, body string }
+	var responses []stored
+	rows, err = tx.Query("SELECT key, body FROM idempotency_keys WHERE body != ''")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s stored
+		if err := rows.Scan(&s.key, &s.body); err != nil {
+			rows.Close()
+			return err
+		}
+		responses = append(responses, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range responses {
+		plain, err := decryptField(s.body)
+		if err != nil {
+			return fmt.Errorf("ответ для ключа %q: %w", s.key, err)
+		}
+		if s.body, err = encryptField(plain); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE idempotency_keys SET body = ? WHERE key = ?", s.body, s.key); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Старые значения могли остаться в полнотекстовых индексах и свободных страницах файла
+	if ftsEnabled {
+		for _, idx := range ftsIndexes {
+			if _, err := db.Exec("INSERT INTO " + idx.table + " (" + idx.table + ") VALUES ('rebuild')"); err != nil {
+				return fmt.Errorf("перестроение %s: %w", idx.table, err)
+			}
+		}
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	log.Printf("rotateEncryptionKey: перешифровано задач: %d, записей журнала: %d, ответов по ключам: %d\n",
+		count, len(snaps), len(responses))
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldEncryption(t *testing.T) {
+	useTestKey(t, "первый ключ")
+	first := fieldKey
+
+	sealed, err := encryptField("Позвонить Ивану")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, encPrefix+first.id+":"), sealed)
+	assert.NotContains(t, sealed, "Ивану")
+
+	again, err := encryptField("Позвонить Ивану")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "одинаковый текст шифруется по-разному")
+
+	plain, err := decryptField(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "Позвонить Ивану", plain)
+
+	// Пустые и открытые значения не меняются
+	empty, err := encryptField("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+	plain, err = decryptField("открытый текст")
+	require.NoError(t, err)
+	assert.Equal(t, "открытый текст", plain)
+
+	// Повреждённый шифротекст не расшифровывается
+	_, err = decryptField(sealed[:len(sealed)-4] + "AAAA")
+	assert.Error(t, err)
+
+	// Без прежнего ключа значение не прочитать, с ним - можно
+	useTestKey(t, "второй ключ")
+	_, err = decryptField(sealed)
+	assert.ErrorIs(t, err, errUnknownKey)
+	useTestKey(t, "второй ключ", "первый ключ")
+	plain, err = decryptField(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "Позвонить Ивану", plain)
+}
+
+func TestEncryptedTasks(t *testing.T) {
+	openTestDB(t)
+	useTestKey(t, "ключ задач")
+	encryptTitle = true
+	handler := http.HandlerFunc(taskHandler)
+
+	rec := serve(t, handler, http.MethodPost, "/api/task", map[string]string{
+		"date": "20990101", "title": "Созвон с Иваном", "comment": "Обсудить отпуск",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	id := fmt.Sprint(decodeJSON(t, rec)["id"])
+	serve(t, handler, http.MethodPost, "/api/task", map[string]string{"date": "20990102", "title": "Купить хлеб"})
+
+	// В базе только шифротекст
+	var title, comment string
+	require.NoError(t, db.QueryRow("SELECT title, comment FROM scheduler WHERE uid = ?", id).Scan(&title, &comment))
+	assert.True(t, strings.HasPrefix(title, encPrefix), title)
+	assert.True(t, strings.HasPrefix(comment, encPrefix), comment)
+
+	// Через API задача читается как обычно
+	rec = serve(t, handler, http.MethodGet, "/api/task?id="+id, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	task := decodeJSON(t, rec)
+	assert.Equal(t, "Созвон с Иваном", task["title"])
+	assert.Equal(t, "Обсудить отпуск", task["comment"])
+
+	// Поиск идёт по расшифрованным задачам, без учёта регистра
+	for search, want := range map[string][]string{
+		"иваном":         {"Созвон с Иваном"},
+		"СОЗВОН отпуск":  {"Созвон с Иваном"},
+		"хлеб":           {"Купить хлеб"},
+		"созвон хлеб":    nil,
+		"шифротекст enc": nil,
+	} {
+		rec = serve(t, http.HandlerFunc(tasksHandler), http.MethodGet, "/api/tasks?search="+strings.ReplaceAll(search, " ", "+"), nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var got []string
+		for _, task := range decodeJSON(t, rec)["tasks"].([]any) {
+			got = append(got, task.(map[string]any)["title"].(string))
+		}
+		assert.Equal(t, want, got, search)
+	}
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	openTestDB(t)
+	handler := withIdempotency(taskHandler)
+
+	// Задача, записанная до включения шифрования
+	rec := serve(t, handler, http.MethodPost, "/api/task", map[string]string{"date": "20990101", "title": "Открытая", "comment": "без ключа"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	plainID := fmt.Sprint(decodeJSON(t, rec)["id"])
+
+	// Задача со старым ключом: ответ на запрос с ключом, запись в журнале
+	useTestKey(t, "старый ключ")
+	body := map[string]string{"date": "20990102", "title": "Старая", "comment": "под старым ключом"}
+	rec = serve(t, handler, http.MethodPost, "/api/task", body, "Idempotency-Key", "rotate-1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	created := rec.Body.String()
+	oldID := fmt.Sprint(decodeJSON(t, rec)["id"])
+	rec = serve(t, handler, http.MethodPut, "/api/task", map[string]string{
+		"id": oldID, "date": "20990103", "title": "Старая", "comment": "исправлено под старым ключом",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	useTestKey(t, "новый ключ", "старый ключ")
+	require.NoError(t, rotateEncryptionKey())
+
+	// Старый ключ больше не нужен: всё зашифровано новым
+	useTestKey(t, "новый ключ")
+	prefix := encPrefix + fieldKey.id + ":"
+	for _, query := range []string{
+		"SELECT comment FROM scheduler",
+		"SELECT before FROM audit_log WHERE before IS NOT NULL",
+		"SELECT after FROM audit_log WHERE after IS NOT NULL",
+		"SELECT body FROM idempotency_keys",
+	} {
+		rows, err := db.Query(query)
+		require.NoError(t, err)
+		n := 0
+		for rows.Next() {
+			var value string
+			require.NoError(t, rows.Scan(&value))
+			assert.True(t, strings.HasPrefix(value, prefix), "%s: %s", query, value)
+			n++
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+		assert.Positive(t, n, query)
+	}
+
+	for id, comment := range map[string]string{plainID: "без ключа", oldID: "исправлено под старым ключом"} {
+		rec = serve(t, handler, http.MethodGet, "/api/task?id="+id, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, comment, decodeJSON(t, rec)["comment"])
+	}
+
+	// Сохранённый ответ по-прежнему отдаётся при повторе
+	rec = serve(t, handler, http.MethodPost, "/api/task", body, "Idempotency-Key", "rotate-1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, created, rec.Body.String())
+
+	// Журнал тоже читается новым ключом
+	rec = serve(t, http.HandlerFunc(auditHandler), http.MethodGet, "/api/audit?task_id="+oldID, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "исправлено под старым ключом")
+}
+
+func TestPlaintextLikeCiphertext(t *testing.T) {
+	openTestDB(t)
+	handler := http.HandlerFunc(taskHandler)
+	const marker = "enc:v1:abc:hello"
+
+	check := func() {
+		t.Helper()
+		rec := serve(t, handler, http.MethodPost, "/api/task", map[string]string{
+			"date": "20990101", "title": marker, "comment": marker,
+		})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		id := fmt.Sprint(decodeJSON(t, rec)["id"])
+
+		rec = serve(t, handler, http.MethodGet, "/api/task?id="+id, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		task := decodeJSON(t, rec)
+		assert.Equal(t, marker, task["title"])
+		assert.Equal(t, marker, task["comment"])
+	}
+
+	// Без ключа текст с меткой шифротекста хранится как есть
+	check()
+	plain, err := decryptField(plainPrefix + marker)
+	require.NoError(t, err)
+	assert.Equal(t, marker, plain)
+
+	// С ключом комментарий шифруется, а открытый заголовок всё равно читается
+	useTestKey(t, "ключ")
+	check()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	busyTimeout  = 5000                  // Сколько миллисекунд SQLite ждёт снятия блокировки
+	txAttempts   = 5                     // Сколько раз повторяем транзакцию при SQLITE_BUSY
+	txRetryDelay = 50 * time.Millisecond // Пауза перед первым повтором, дальше удваивается
+)
+
+// dbtx - общие методы *sql.DB и *sql.Tx, чтобы одни и те же функции работали в транзакции и без неё
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// dataSourceName - строка подключения к файлу базы.
+// WAL позволяет читать во время записи, _txlock=immediate делает каждую транзакцию
+// BEGIN IMMEDIATE: блокировка на запись берётся сразу, а не при первом UPDATE,
+// поэтому два запроса не могут одновременно прочитать задачу и изменить её по старым данным.
+// readOnly открывает файл только для чтения, режим журнала тогда не меняется.
+func dataSourceName(dbFile string, readOnly bool) string {
+	if readOnly {
+		return fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", dbFile, busyTimeout)
+	}
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbFile, busyTimeout)
+}
+
+// dbTime - время для записи в базу: RFC3339 в UTC. Строки в одном поясе сравниваются
+// как время, на этом построены сроки хранения, фильтры журнала и порядок истории.
+func dbTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// withTx - выполняет fn в транзакции. Если база занята (SQLITE_BUSY),
+// транзакция повторяется до txAttempts раз с растущей паузой.
+// Когда ctx отменён, транзакция откатывается и повторов больше нет.
+func withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	delay := txRetryDelay
+	var err error
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		if err = runTx(ctx, fn); !isBusy(err) {
+			return err
+		}
+		log.Printf("withTx: база занята, попытка %d из %d: %v\n", attempt, txAttempts, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// runTx - один проход транзакции: откат при ошибке, иначе фиксация
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isBusy - ошибка из-за того, что база заблокирована другим соединением
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// isUniqueViolation - нарушено ли ограничение UNIQUE
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// migrateDB - доводит схему базы до актуальной версии.
+// Каждый шаг можно выполнять повторно, поэтому функция вызывается при каждом запуске.
+func migrateDB() error {
+	// Таблица с историей выполнений задач
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS completions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            task_id INTEGER NOT NULL,
+            scheduled_date TEXT NOT NULL,
+            completed_at TEXT NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_completions_task ON completions (task_id);
+    `)
+	if err != nil {
+		return fmt.Errorf("таблица completions: %w", err)
+	}
+
+	// Статус задачи вместо удаления выполненных
+	if err := ensureColumn("scheduler", "status", "TEXT NOT NULL DEFAULT 'open'"); err != nil {
+		return err
+	}
+	if err := ensureColumn("scheduler", "completed_at", "TEXT"); err != nil {
+		return err
+	}
+	// Версия задачи для проверки If-Match
+	if err := ensureColumn("scheduler", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_status_date ON scheduler (status, date)"); err != nil {
+		return fmt.Errorf("индекс idx_status_date: %w", err)
+	}
+
+	// Журнал изменений задач
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            created_at TEXT NOT NULL,
+            actor TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            action TEXT NOT NULL,
+            task_id INTEGER NOT NULL,
+            before TEXT,
+            after TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_audit_task ON audit_log (task_id);
+        CREATE INDEX IF NOT EXISTS idx_audit_created ON audit_log (created_at);
+    `)
+	if err != nil {
+		return fmt.Errorf("таблица audit_log: %w", err)
+	}
+
+	// Архив старых выполненных задач
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS archive (
+            id INTEGER PRIMARY KEY,
+            date TEXT NOT NULL,
+            title TEXT NOT NULL,
+            comment TEXT,
+            repeat TEXT,
+            status TEXT NOT NULL,
+            completed_at TEXT,
+            version INTEGER NOT NULL,
+            archived_at TEXT NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_archive_completed ON archive (completed_at);
+    `)
+	if err != nil {
+		return fmt.Errorf("таблица archive: %w", err)
+	}
+
+	// Публичные ID задач: ULID не зависит от счётчика конкретной базы
+	for _, table := range []string{"scheduler", "archive"} {
+		if err := ensureColumn(table, "uid", "TEXT"); err != nil {
+			return err
+		}
+		if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_" + table + "_uid ON " + table + " (uid)"); err != nil {
+			return fmt.Errorf("индекс idx_%s_uid: %w", table, err)
+		}
+		if err := assignULIDs(table); err != nil {
+			return err
+		}
+	}
+
+	// В журнале публичный ID нужен и для удалённых задач, поэтому он хранится рядом с ключом
+	if err := ensureColumn("audit_log", "task_uid", "TEXT"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+        CREATE INDEX IF NOT EXISTS idx_audit_task_uid ON audit_log (task_uid);
+        UPDATE audit_log SET task_uid = COALESCE(
+            (SELECT uid FROM scheduler WHERE scheduler.id = audit_log.task_id),
+            (SELECT uid FROM archive WHERE archive.id = audit_log.task_id))
+        WHERE task_uid IS NULL;
+    `)
+	if err != nil {
+		return fmt.Errorf("uid задач в audit_log: %w", err)
+	}
+
+	// Сохранённые списки: запросы q под названием
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS views (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL UNIQUE,
+            query TEXT NOT NULL
+        );
+    `)
+	if err != nil {
+		return fmt.Errorf("таблица views: %w", err)
+	}
+
+	// Ответы на запросы с Idempotency-Key; status 0 - запрос ещё выполняется
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS idempotency_keys (
+            key TEXT PRIMARY KEY,
+            fingerprint TEXT NOT NULL,
+            status INTEGER NOT NULL DEFAULT 0,
+            headers TEXT NOT NULL DEFAULT '{}',
+            body TEXT NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_idempotency_created ON idempotency_keys (created_at);
+    `)
+	if err != nil {
+		return fmt.Errorf("таблица idempotency_keys: %w", err)
+	}
+
+	// Раньше время писалось с местным поясом, переводим его в UTC как в dbTime
+	for _, c := range []struct{ table, column string }{
+		{"scheduler", "completed_at"},
+		{"archive", "completed_at"},
+		{"archive", "archived_at"},
+		{"completions", "completed_at"},
+		{"audit_log", "created_at"},
+		{"idempotency_keys", "created_at"},
+	} {
+		utc := "strftime('%Y-%m-%dT%H:%M:%SZ', " + c.column + ")"
+		_, err := db.Exec("UPDATE " + c.table + " SET " + c.column + " = " + utc +
+			" WHERE " + c.column + " NOT LIKE '%Z' AND " + utc + " IS NOT NULL")
+		if err != nil {
+			return fmt.Errorf("время в %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	// Полнотекстовый поиск по задачам
+	if err := initFTS(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ensureColumn - добавляет колонку в таблицу, если её там ещё нет
+func ensureColumn(table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("проверка колонки %s.%s: %w", table, column, err)
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("добавление колонки %s.%s: %w", table, column, err)
+	}
+	log.Printf("migrateDB: добавлена колонка %s.%s\n", table, column)
+	return nil
+}
+
+// assignULIDs - выдаёт ULID задачам, у которых его ещё нет.
+// Время в ULID берётся из порядка id, чтобы старые задачи сортировались как раньше.
+func assignULIDs(table string) error {
+	rows, err := db.Query("SELECT id FROM " + table + " WHERE uid IS NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("задачи без uid в %s: %w", table, err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	base := time.Now().Add(-time.Duration(len(ids)) * time.Millisecond)
+	for i, id := range ids {
+		uid := newULID(base.Add(time.Duration(i) * time.Millisecond))
+		if _, err := tx.Exec("UPDATE "+table+" SET uid = ? WHERE id = ?", uid, id); err != nil {
+			return fmt.Errorf("uid для задачи %d в %s: %w", id, table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("migrateDB: выданы ULID задачам в %s: %d\n", table, len(ids))
+	return nil
+}
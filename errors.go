@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// statusClientClosedRequest - клиент закрыл соединение, не дождавшись ответа (код nginx)
+const statusClientClosedRequest = 499
+
+// Коды ошибок API. Клиент различает ошибки по коду: он не меняется,
+// а текст сообщения может уточняться. Полный список с описаниями - в README.
+const (
+	// Запрос
+	CodeInvalidJSON      = "invalid_json"       // Тело запроса - не JSON нужного вида
+	CodeNotFound         = "not_found"          // Нет такого адреса API
+	CodeMethodNotAllowed = "method_not_allowed" // Метод не поддерживается
+	CodeIDRequired       = "id_required"        // Не указан ID
+	CodeIDMismatch       = "id_mismatch"        // ID в теле не совпадает с ID в адресе
+	CodeInvalidParam     = "invalid_param"      // Неправильный параметр запроса, имя - в field
+	CodeInvalidCursor    = "invalid_cursor"     // Курсор испорчен или выдан для другого порядка
+	CodeInvalidQuery     = "invalid_query"      // Ошибка в запросе q или в запросе списка
+	CodeInvalidBatch     = "invalid_batch"      // Пакет пустой, слишком большой или с неизвестной операцией
+
+	// Проверка задачи и других данных
+	CodeFieldRequired   = "field_required"    // Не заполнено обязательное поле, имя - в field
+	CodeTitleRequired   = "title_required"    // Пустой заголовок задачи
+	CodeInvalidDate     = "invalid_date"      // Неправильная дата
+	CodeInvalidRepeat   = "invalid_repeat"    // Ошибка в правиле повторения
+	CodeRepeatNeedsDate = "repeat_needs_date" // Повторяющаяся задача без даты
+	CodeInvalidField    = "invalid_field"     // Неправильное значение поля, имя - в field
+	CodeReadOnlyField   = "read_only_field"   // Поле нельзя изменить
+	CodeUnknownField    = "unknown_field"     // Неизвестное поле
+
+	// Состояние задач и других записей
+	CodeTaskNotFound     = "task_not_found"    // Задача не найдена
+	CodeViewNotFound     = "view_not_found"    // Сохранённый список не найден
+	CodeAuditNotFound    = "audit_not_found"   // Запись журнала не найдена
+	CodeVersionMismatch  = "version_mismatch"  // Задача изменилась после чтения (If-Match)
+	CodeAlreadyCompleted = "already_completed" // Задача уже выполнена
+	CodeNotCompleted     = "not_completed"     // Задача ещё не выполнена, отменять нечего
+	CodeAlreadyScheduled = "already_scheduled" // Задача уже стоит на дату
+	CodeViewNameTaken    = "view_name_taken"   // Список с таким названием уже есть
+	CodeCannotRevert     = "cannot_revert"     // Это изменение нельзя откатить
+	CodeTaskArchived     = "task_archived"     // Задача в архиве, изменить её нельзя
+
+	// Повтор запроса с Idempotency-Key
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"  // Ключ уже использован для другого запроса
+	CodeIdempotencyInProgress = "idempotency_in_progress" // Запрос с этим ключом ещё выполняется
+
+	// Вход
+	CodeAuthRequired    = "auth_required"    // Нет токена или он недействителен
+	CodeInvalidPassword = "invalid_password" // Неправильный пароль
+
+	// Сервер
+	CodeMaintenance = "maintenance"      // Режим обслуживания, изменения недоступны
+	CodeReadOnly    = "read_only"        // База открыта только для чтения
+	CodeTimeout     = "timeout"          // Запрос не уложился в срок
+	CodeCanceled    = "request_canceled" // Клиент отменил запрос
+	CodeEncryption  = "encryption_error" // Не получилось зашифровать или расшифровать задачу
+	CodeBackup      = "backup_failed"    // Не получилось сделать резервную копию
+	CodeStorage     = "storage_error"    // Ошибка базы данных
+	CodeInternal    = "internal_error"   // Прочие внутренние ошибки
+)
+
+// apiError - ошибка, которую нужно отдать клиенту с кодом status.
+// Её возвращают из функций, которые сами не пишут ответ, например из транзакций.
+// Текст не хранится: он берётся из messages по key на языке запроса.
+type apiError struct {
+	status  int
+	code    string
+	key     string         // Ключ сообщения в messages, по умолчанию совпадает с code
+	args    []any          // Аргументы сообщения
+	field   string         // Поле или параметр запроса, к которому относится ошибка
+	details map[string]any // Подробности для клиента, например номер операции в пакете
+}
+
+func (e *apiError) Error() string {
+	return message(e.key, defaultLang, e.field, e.args...)
+}
+
+// newAPIError - создаёт ошибку для клиента
+func newAPIError(status int, code string) *apiError {
+	return &apiError{status: status, code: code, key: code}
+}
+
+// newFieldError - ошибка 400 в поле или параметре запроса field
+func newFieldError(code, field string) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: code, key: code, field: field}
+}
+
+// text - уточняет сообщение ошибки: key из messages и его аргументы
+func (e *apiError) text(key string, args ...any) *apiError {
+	e.key, e.args = key, args
+	return e
+}
+
+// body - ошибка в том виде, в котором её видит клиент, с сообщением на языке lang
+func (e *apiError) body(lang string) errorBody {
+	return errorBody{Code: e.code, Message: message(e.key, lang, e.field, e.args...), Field: e.field, Details: e.details}
+}
+
+// errorBody - ошибка в ответе: {"error": {"code", "message", "field", "details"}}
+type errorBody struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Field   string         `json:"field,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// writeError - отдаёт ошибку клиенту в JSON на языке запроса.
+// Истёкший срок запроса превращается в 503, отменённый клиентом запрос - в 499,
+// остальные ошибки, не предназначенные клиенту, - в 500 с сообщением fallback.
+func writeError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	lang := requestLang(r)
+	status, body := errorStatus(err, fallback, lang)
+	writeErrorBody(w, status, lang, body)
+}
+
+// writeAPIError - отдаёт клиенту ошибку, созданную в обработчике
+func writeAPIError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	lang := requestLang(r)
+	writeErrorBody(w, e.status, lang, e.body(lang))
+}
+
+// writeErrorBody - пишет ошибку в едином виде. http.Error не подходит:
+// он заменяет Content-Type на text/plain.
+func writeErrorBody(w http.ResponseWriter, status int, lang string, body errorBody) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]errorBody{"error": body})
+}
+
+// errorStatus - код ответа и ошибка для клиента, правила те же, что у writeError.
+// fallback - ключ сообщения; код ошибки - его часть до точки.
+func errorStatus(err error, fallback, lang string) (int, errorBody) {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+		return e.status, e.body(lang)
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("writeError: запрос не уложился в срок: %v\n", err)
+		return http.StatusServiceUnavailable, errorBody{Code: CodeTimeout, Message: message(CodeTimeout, lang, "")}
+	case errors.Is(err, context.Canceled):
+		log.Printf("writeError: клиент отменил запрос: %v\n", err)
+		return statusClientClosedRequest, errorBody{Code: CodeCanceled, Message: message(CodeCanceled, lang, "")}
+	}
+	// Клиент видит только общий код, настоящая причина остаётся в журнале сервера
+	log.Printf("writeError: %s: %v\n", fallback, err)
+	code, _, _ := strings.Cut(fallback, ".")
+	return http.StatusInternalServerError, errorBody{Code: code, Message: message(fallback, lang, "")}
+}
+
+// apiNotFoundHandler - ответ на адреса /api/, для которых нет обработчика
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeNotFound))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatusLogsCause(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	status, body := errorStatus(errors.New("disk I/O error"), CodeStorage+".update", LangRU)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, CodeStorage, body.Code)
+	assert.NotContains(t, body.Message, "disk")
+	assert.Contains(t, buf.String(), "disk I/O error")
+
+	// Ошибки для клиента не засоряют журнал
+	buf.Reset()
+	status, _ = errorStatus(newAPIError(http.StatusNotFound, CodeTaskNotFound), CodeStorage, LangRU)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// taskETag - ETag задачи, построенный по её версии
+func taskETag(version string) string {
+	return `"` + version + `"`
+}
+
+// listETag - ETag списка задач: меняется, если изменилась любая задача или состав списка
+func listETag(tasks []Task) string {
+	h := sha256.New()
+	for _, task := range tasks {
+		fmt.Fprintf(h, "%s:%s;", task.ID, task.Version)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:8])
+}
+
+// ifMatch - проверяет заголовок If-Match против текущей версии задачи.
+// Без заголовка запрос разрешён, "*" совпадает с любой существующей версией.
+func ifMatch(r *http.Request, version string) bool {
+	return matchETag(r.Header.Get("If-Match"), version)
+}
+
+// matchETag - проверяет значение в формате If-Match против версии задачи.
+// If-Match требует сильного сравнения (RFC 9110), поэтому слабый ETag W/"..." не совпадает ни с чем.
+func matchETag(header, version string) bool {
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if tag == taskETag(version) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Поля, по которым можно сортировать список задач
+const (
+	SortDate    = "date"
+	SortTitle   = "title"
+	SortCreated = "created"
+)
+
+// taskFilter - условия отбора задач в списке, все условия объединяются через И
+type taskFilter struct {
+	From       string // Дата не раньше, 20060102
+	To         string // Дата не позже, 20060102
+	Overdue    bool   // Дата уже прошла
+	Today      bool   // Дата - сегодня
+	HasRepeat  *bool  // Есть ли правило повторения
+	RepeatKind string // Вид правила: d или y
+}
+
+// parseTaskFilter - читает фильтры из параметров запроса:
+// from, to, overdue=1, today=1, has_repeat=1|0, repeat_kind
+func parseTaskFilter(q url.Values) (taskFilter, error) {
+	var f taskFilter
+	for _, p := range []struct {
+		param string
+		value *string
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := q.Get(p.param)
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("20060102", v); err != nil {
+			return f, newFieldError(CodeInvalidParam, p.param).text(CodeInvalidParam + ".date")
+		}
+		*p.value = v
+	}
+
+	f.Overdue = q.Get("overdue") == "1"
+	f.Today = q.Get("today") == "1"
+
+	switch q.Get("has_repeat") {
+	case "":
+	case "1":
+		f.HasRepeat = new(bool)
+		*f.HasRepeat = true
+	case "0":
+		f.HasRepeat = new(bool)
+	default:
+		return f, newFieldError(CodeInvalidParam, "has_repeat").text(CodeInvalidParam+".enum", "1, 0")
+	}
+
+	switch kind := q.Get("repeat_kind"); kind {
+	case "", RepeatDaily, RepeatYearly:
+		f.RepeatKind = kind
+	default:
+		return f, newFieldError(CodeInvalidParam, "repeat_kind").text(CodeInvalidParam+".enum", "d, y")
+	}
+	return f, nil
+}
+
+// where - условия SQL и их аргументы; today - сегодняшняя дата в формате 20060102
+func (f taskFilter) where(today string) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.From != "" {
+		where = append(where, "date >= ?")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where = append(where, "date <= ?")
+		args = append(args, f.To)
+	}
+	if f.Overdue {
+		where = append(where, "date < ?")
+		args = append(args, today)
+	}
+	if f.Today {
+		where = append(where, "date = ?")
+		args = append(args, today)
+	}
+	if f.HasRepeat != nil && *f.HasRepeat {
+		where = append(where, "repeat != ''")
+	} else if f.HasRepeat != nil {
+		where = append(where, "COALESCE(repeat, '') = ''")
+	}
+	if f.RepeatKind != "" {
+		where = append(where, "(repeat = ? OR repeat LIKE ?)")
+		args = append(args, f.RepeatKind, f.RepeatKind+" %")
+	}
+	return where, args
+}
+
+// taskSort - порядок задач в списке. Пустое By - порядок по умолчанию.
+type taskSort struct {
+	By   string
+	Desc bool
+}
+
+// parseTaskSort - читает sort=date|title|created и order=asc|desc
+func parseTaskSort(q url.Values) (taskSort, error) {
+	var s taskSort
+	switch by := q.Get("sort"); by {
+	case "", SortDate, SortTitle, SortCreated:
+		s.By = by
+	default:
+		return s, newFieldError(CodeInvalidParam, "sort").text(CodeInvalidParam+".enum", "date, title, created")
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		s.Desc = true
+	default:
+		return s, newFieldError(CodeInvalidParam, "order").text(CodeInvalidParam+".enum", "asc, desc")
+	}
+	return s, nil
+}
+
+// column - колонка сортировки; для created порядок задаёт сам ключ, колонка пустая
+func (s taskSort) column() string {
+	switch s.By {
+	case SortDate, SortTitle:
+		return s.By
+	}
+	return ""
+}
+
+// value - значение колонки сортировки у задачи, из него строится курсор
+func (s taskSort) value(task Task) string {
+	switch s.By {
+	case SortDate:
+		return task.Date
+	case SortTitle:
+		return task.Title
+	}
+	return ""
+}
+
+// String - порядок в виде строки, сохраняется в курсоре
+func (s taskSort) String() string {
+	if s.Desc {
+		return s.By + " desc"
+	}
+	return s.By
+}
+
+// sortTasks - сортирует задачи в Go, когда порядок нельзя получить в SQL
+// (например, заголовки зашифрованы). При равных значениях порядок - по ключу.
+func sortTasks(tasks []Task, s taskSort) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := s.value(tasks[i]), s.value(tasks[j])
+		if a == b {
+			a, b = tasks[i].Key, tasks[j].Key
+			// Ключи - целые числа, сравниваем их по длине, затем по значению
+			if len(a) != len(b) {
+				return (len(a) < len(b)) != s.Desc
+			}
+		}
+		return (a < b) != s.Desc
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	fuzzyCandidates = 500 // Сколько задач с общими триграммами проверяем точно
+	fuzzyThreshold  = 0.6 // Минимальное сходство, при котором задача попадает в выдачу
+)
+
+// trigramJoin - подзапрос с задачами, у которых есть общие триграммы с запросом.
+// Сначала идут задачи с наибольшим числом совпадений.
+const trigramJoin = ` JOIN (
+        SELECT rowid AS match_id FROM scheduler_trigram WHERE scheduler_trigram MATCH ?
+        ORDER BY rank LIMIT ?
+    ) AS m ON m.match_id = scheduler.id`
+
+// trigramQuery - запрос к триграммному индексу: любая тройка символов из слов запроса.
+// Слова короче трёх символов триграмм не дают, для них возвращается пустая строка.
+func trigramQuery(search string) string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, word := range searchWords(search) {
+		runes := []rune(word)
+		for i := 0; i+3 <= len(runes); i++ {
+			tri := string(runes[i : i+3])
+			if seen[tri] {
+				continue
+			}
+			seen[tri] = true
+			terms = append(terms, `"`+strings.ReplaceAll(tri, `"`, `""`)+`"`)
+		}
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// searchWords - слова строки в нижнем регистре без знаков препинания
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// fuzzyScore - сходство задачи с запросом от 0 до 1.
+// Для каждого слова запроса ищется самое похожее слово в заголовке или комментарии,
+// итог - среднее по словам запроса.
+func fuzzyScore(task Task, search string) float64 {
+	queryWords := searchWords(search)
+	if len(queryWords) == 0 {
+		return 0
+	}
+	taskWords := searchWords(task.Title + " " + task.Comment)
+
+	var total float64
+	for _, q := range queryWords {
+		best := 0.0
+		for _, t := range taskWords {
+			if sim := wordSimilarity(q, t); sim > best {
+				best = sim
+			}
+		}
+		total += best
+	}
+	return total / float64(len(queryWords))
+}
+
+// wordSimilarity - сходство двух слов по расстоянию Левенштейна.
+// Начало слова считается полным совпадением, как в обычном поиске по префиксу.
+func wordSimilarity(query, word string) float64 {
+	if strings.HasPrefix(word, query) {
+		return 1
+	}
+	q, w := []rune(query), []rune(word)
+	longest := len(q)
+	if len(w) > longest {
+		longest = len(w)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(q, w))/float64(longest)
+}
+
+// levenshtein - минимальное число вставок, удалений и замен символов
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// rankFuzzy - оставляет похожие задачи и сортирует их по убыванию сходства
+func rankFuzzy(tasks []Task, search string) []Task {
+	var ranked []Task
+	for _, task := range tasks {
+		task.Score = fuzzyScore(task, search)
+		if task.Score >= fuzzyThreshold {
+			ranked = append(ranked, task)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Date < ranked[j].Date
+	})
+	return ranked
+}
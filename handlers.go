@@ -1,22 +1,51 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Статусы задачи
+const (
+	StatusOpen      = "open"
+	StatusCompleted = "completed"
+)
+
 // Task - структура для задачи, как она хранится в базе
 type Task struct {
-	ID      string `json:"id"`
-	Date    string `json:"date"`
-	Title   string `json:"title"`
-	Comment string `json:"comment"`
-	Repeat  string `json:"repeat"`
+	ID          string `json:"id"` // Публичный ID (ULID), у старых задач без ULID - целый ключ
+	Key         string `json:"-"`  // Целый ключ строки в базе, на него ссылаются история и журнал
+	Date        string `json:"date"`
+	Title       string `json:"title"`
+	Comment     string `json:"comment"`
+	Repeat      string `json:"repeat"`
+	Status      string `json:"status,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	Version     string `json:"version,omitempty"` // Растёт при каждом изменении, отдаётся как ETag
+	Backlog     bool   `json:"backlog,omitempty"` // Задача "когда-нибудь": без даты, в бэклоге
+
+	// Фрагменты с подсвеченными совпадениями, заполняются только при поиске
+	TitleSnippet   string `json:"title_snippet,omitempty"`
+	CommentSnippet string `json:"comment_snippet,omitempty"`
+	// Сходство с запросом при нечётком поиске
+	Score float64 `json:"score,omitempty"`
+	// Разобранное правило повторения, есть у всех повторяющихся задач
+	RepeatRule *RepeatRule `json:"repeat_rule,omitempty"`
 }
 
+// taskColumns - колонки задачи в порядке полей для Scan
+const taskColumns = "id, COALESCE(uid, CAST(id AS TEXT)), date, title, comment, repeat, status, COALESCE(completed_at, ''), version"
+
+// taskByID - условие поиска задачи по ID: подходит и ULID, и прежний целый ID.
+// Аргумент ID передаётся дважды.
+const taskByID = "(uid = ? OR id = ?)"
+
 // taskHandler - обработчик для маршрута /api/task
 func taskHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -26,74 +55,138 @@ func taskHandler(w http.ResponseWriter, r *http.Request) {
 		addTask(w, r)
 	case "PUT":
 		updateTask(w, r)
+	case "PATCH":
+		patchTask(w, r)
 	case "DELETE":
 		deleteTask(w, r)
 	default:
-		http.Error(w, `{"error":"Этот метод не работает"}`, http.StatusMethodNotAllowed)
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
 	}
 }
 
-// addTask - добавляет новую задачу в базу
-func addTask(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+// taskInput - задача в теле запроса на создание или изменение
+type taskInput struct {
+	Task
+	Repeat json.RawMessage `json:"repeat"` // Строка правила или объект RepeatRule
+}
 
-	var task struct {
-		Date    string `json:"date"`
-		Title   string `json:"title"`
-		Comment string `json:"comment"`
-		Repeat  string `json:"repeat"`
+// task - задача из запроса с правилом повторения в виде строки
+func (in *taskInput) task() (Task, error) {
+	task := in.Task
+	repeat, err := decodeRepeat(in.Repeat)
+	if err != nil {
+		return task, repeatError(err)
 	}
+	task.Repeat = repeat
+	return task, nil
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		http.Error(w, `{"error":"Ошибка в JSON"}`, http.StatusBadRequest)
-		return
+// validateTask - проверяет задачу перед записью и приводит дату к рабочему виду:
+// пустая или прошедшая дата заменяется на сегодняшнюю.
+// Задача из бэклога остаётся без даты, повторяться она не может.
+func validateTask(task *Task, now time.Time) error {
+	if task.Title == "" {
+		return newFieldError(CodeTitleRequired, "title")
 	}
 
-	if task.Title == "" {
-		http.Error(w, `{"error":"Заголовок обязателен"}`, http.StatusBadRequest)
-		return
+	if task.Backlog {
+		if task.Date != "" {
+			return newFieldError(CodeInvalidDate, "date").text(CodeInvalidDate + ".backlog")
+		}
+		return checkRepeat(*task, now)
+	}
+
+	date, err := normalizeDate(task.Date, now)
+	if err != nil {
+		return err
 	}
+	task.Date = date
+	return checkRepeat(*task, now)
+}
 
-	now := time.Now()
+// normalizeDate - проверяет дату задачи; пустая или прошедшая дата заменяется на сегодняшнюю
+func normalizeDate(date string, now time.Time) (string, error) {
 	today := now.Format("20060102")
-	if task.Date == "" {
-		task.Date = today
+	if date == "" {
+		return today, nil
 	}
 
-	dateParsed, err := time.Parse("20060102", task.Date)
+	dateParsed, err := time.Parse("20060102", date)
 	if err != nil {
-		http.Error(w, `{"error":"Неправильная дата"}`, http.StatusBadRequest)
-		return
+		return "", newFieldError(CodeInvalidDate, "date")
 	}
 
 	// Если дата раньше today, заменяем на today
 	if dateParsed.Before(now) {
-		task.Date = today
+		return today, nil
 	}
+	return date, nil
+}
 
-	// Проверяем правило повторения
-	if task.Repeat != "" {
-		_, err := NextDateSimple(now, task.Date, task.Repeat)
-		if err != nil {
-			http.Error(w, `{"error":"Ошибка в правиле повторения"}`, http.StatusBadRequest)
-			return
-		}
+// checkRepeat - проверяет правило повторения задачи вместе с её датой
+func checkRepeat(task Task, now time.Time) error {
+	if task.Repeat == "" {
+		return nil
 	}
+	if task.Date == "" {
+		return newFieldError(CodeRepeatNeedsDate, "date")
+	}
+	if _, err := parseRepeat(task.Repeat); err != nil {
+		return repeatError(err)
+	}
+	return nil
+}
 
-	result, err := db.Exec("INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, ?, ?)",
-		task.Date, task.Title, task.Comment, task.Repeat)
-	if err != nil {
-		http.Error(w, `{"error":"Не получилось добавить задачу"}`, http.StatusInternalServerError)
+// addTask - добавляет новую задачу в базу
+func addTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var input taskInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
 		return
 	}
 
-	id, err := result.LastInsertId()
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = insertTask(tx, r, input, time.Now())
+		return err
+	})
 	if err != nil {
-		http.Error(w, `{"error":"Не могу получить ID"}`, http.StatusInternalServerError)
+		writeError(w, r, err, CodeStorage+".create")
 		return
 	}
 
-	fmt.Fprintf(w, `{"id":"%d"}`, id)
+	fmt.Fprintf(w, `{"id":"%s"}`, after.ID)
+}
+
+// insertTask - проверяет задачу из запроса и добавляет её внутри транзакции
+func insertTask(tx *sql.Tx, r *http.Request, input taskInput, now time.Time) (*Task, error) {
+	task, err := input.task()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTask(&task, now); err != nil {
+		return nil, err
+	}
+
+	stored := Task{Title: task.Title, Comment: task.Comment}
+	if err := encryptTask(&stored); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, CodeEncryption)
+	}
+
+	id := newULID(now)
+	_, err = tx.ExecContext(r.Context(), "INSERT INTO scheduler (uid, date, title, comment, repeat) VALUES (?, ?, ?, ?, ?)",
+		id, task.Date, stored.Title, stored.Comment, task.Repeat)
+	if err != nil {
+		return nil, err
+	}
+	after, err := loadTask(r.Context(), tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return after, writeAudit(tx, r, AuditCreate, after.Key, nil, after)
 }
 
 // getTask - получает задачу по ID
@@ -102,81 +195,118 @@ func getTask(w http.ResponseWriter, r *http.Request) {
 
 	id := r.URL.Query().Get("id")
 	if id == "" {
-		http.Error(w, `{"error":"ID не указан"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
 		return
 	}
 
-	var task Task
-	err := db.QueryRow("SELECT id, date, title, comment, repeat FROM scheduler WHERE id = ?", id).
-		Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	task, err := loadTask(r.Context(), db, id)
 	if err == sql.ErrNoRows {
-		http.Error(w, `{"error":"Задача не найдена"}`, http.StatusNotFound)
+		writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeTaskNotFound))
 		return
 	} else if err != nil {
-		http.Error(w, `{"error":"Ошибка в базе"}`, http.StatusInternalServerError)
+		writeError(w, r, err, CodeStorage)
 		return
 	}
 
+	w.Header().Set("ETag", taskETag(task.Version))
 	json.NewEncoder(w).Encode(task)
 }
 
+// loadTask - читает задачу из базы (или транзакции) по ULID или целому ID
+func loadTask(ctx context.Context, q dbtx, id string) (*Task, error) {
+	var task Task
+	err := q.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM scheduler WHERE "+taskByID, id, id).
+		Scan(&task.Key, &task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Status, &task.CompletedAt, &task.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareTask(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// prepareTask - расшифровывает задачу после чтения из базы и заполняет поля,
+// которых нет в таблице
+func prepareTask(task *Task) error {
+	if err := decryptTask(task); err != nil {
+		return err
+	}
+	task.Backlog = task.Date == ""
+	if task.Repeat != "" {
+		// Правила w и m из старых баз не разбираются, у таких задач остаётся только строка
+		task.RepeatRule, _ = parseRepeat(task.Repeat)
+	}
+	return nil
+}
+
 // updateTask - обновляет задачу
 func updateTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-	var task Task
-	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		http.Error(w, `{"error":"Ошибка в JSON"}`, http.StatusBadRequest)
+	var input taskInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
 		return
 	}
 
-	if task.ID == "" {
-		http.Error(w, `{"error":"ID не указан"}`, http.StatusBadRequest)
-		return
-	}
-	if task.Title == "" {
-		http.Error(w, `{"error":"Заголовок обязателен"}`, http.StatusBadRequest)
+	// Чтение, проверка версии и запись идут в одной транзакции
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = replaceTask(tx, r, input, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
 		return
 	}
 
-	now := time.Now()
-	today := now.Format("20060102")
-	if task.Date == "" {
-		task.Date = today
-	}
+	w.Header().Set("ETag", taskETag(after.Version))
+	w.Write([]byte(`{}`))
+}
 
-	dateParsed, err := time.Parse("20060102", task.Date)
+// replaceTask - проверяет задачу из запроса и записывает её поверх прежней внутри транзакции.
+// match - ожидаемая версия в формате If-Match, пустая строка - любая.
+func replaceTask(tx *sql.Tx, r *http.Request, input taskInput, match string) (*Task, error) {
+	task, err := input.task()
 	if err != nil {
-		http.Error(w, `{"error":"Неправильная дата"}`, http.StatusBadRequest)
-		return
+		return nil, err
+	}
+	if task.ID == "" {
+		return nil, newFieldError(CodeIDRequired, "id")
+	}
+	if err := validateTask(&task, time.Now()); err != nil {
+		return nil, err
 	}
 
-	if dateParsed.Before(now) {
-		task.Date = today
+	stored := task
+	if err := encryptTask(&stored); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, CodeEncryption)
 	}
 
-	if task.Repeat != "" {
-		_, err := NextDateSimple(now, task.Date, task.Repeat)
-		if err != nil {
-			http.Error(w, `{"error":"Ошибка в правиле повторения"}`, http.StatusBadRequest)
-			return
-		}
+	before, err := loadTask(r.Context(), tx, task.ID)
+	if err == sql.ErrNoRows {
+		return nil, newAPIError(http.StatusNotFound, CodeTaskNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	if !matchETag(match, before.Version) {
+		return nil, newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
 	}
 
-	result, err := db.Exec("UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ? WHERE id = ?",
-		task.Date, task.Title, task.Comment, task.Repeat, task.ID)
+	_, err = tx.ExecContext(r.Context(), `UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ?, version = version + 1
+		WHERE id = ?`,
+		stored.Date, stored.Title, stored.Comment, stored.Repeat, before.Key)
 	if err != nil {
-		http.Error(w, `{"error":"Ошибка обновления"}`, http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil || rows == 0 {
-		http.Error(w, `{"error":"Задача не найдена"}`, http.StatusNotFound)
-		return
+	after, err := loadTask(r.Context(), tx, before.Key)
+	if err != nil {
+		return nil, err
 	}
-
-	w.Write([]byte(`{}`))
+	return after, writeAudit(tx, r, AuditUpdate, before.Key, before, after)
 }
 
 // deleteTask - удаляет задачу по ID
@@ -185,50 +315,241 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 
 	id := r.URL.Query().Get("id")
 	if id == "" {
-		http.Error(w, `{"error":"ID не указан"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM scheduler WHERE id = ?", id)
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		return removeTask(tx, r, id, r.Header.Get("If-Match"))
+	})
 	if err != nil {
-		http.Error(w, `{"error":"Ошибка удаления"}`, http.StatusInternalServerError)
+		writeError(w, r, err, CodeStorage+".delete")
 		return
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil || rows == 0 {
-		http.Error(w, `{"error":"Задача не найдена"}`, http.StatusNotFound)
-		return
+	w.Write([]byte(`{}`))
+}
+
+// removeTask - удаляет задачу внутри транзакции.
+// match - ожидаемая версия в формате If-Match, пустая строка - любая.
+func removeTask(tx *sql.Tx, r *http.Request, id, match string) error {
+	before, err := loadTask(r.Context(), tx, id)
+	if err == sql.ErrNoRows {
+		return newAPIError(http.StatusNotFound, CodeTaskNotFound)
+	} else if err != nil {
+		return err
+	}
+	if !matchETag(match, before.Version) {
+		return newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
 	}
 
-	w.Write([]byte(`{}`))
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM scheduler WHERE id = ?", before.Key); err != nil {
+		return err
+	}
+	return writeAudit(tx, r, AuditDelete, before.Key, before, nil)
 }
 
-// tasksHandler - возвращает список задач
+// tasksHandler - возвращает список задач постранично.
+// limit - размер страницы, cursor - значение next_cursor из предыдущего ответа,
+// count=1 - добавить в ответ total, число всех подходящих задач.
+// Фильтры (from, to, overdue, today, has_repeat, repeat_kind), запрос q или сохранённый
+// список view и сортировка (sort, order) сочетаются с поиском и друг с другом.
 func tasksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	search := r.URL.Query().Get("search")
+	fuzzy := r.URL.Query().Get("fuzzy") == "1"
+	withTotal := r.URL.Query().Get("count") == "1"
+	backlog := r.URL.Query().Get("backlog") == "1"
+
+	// Запрос сохранённого списка объединяется с q через И
+	queryText := r.URL.Query().Get("q")
+	if id := r.URL.Query().Get("view"); id != "" {
+		view, err := loadView(r.Context(), db, id)
+		if err == sql.ErrNoRows {
+			writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeViewNotFound))
+			return
+		} else if err != nil {
+			writeError(w, r, err, CodeStorage)
+			return
+		}
+		queryText = view.Query + " " + queryText
+	}
+	userQuery, err := parseTaskQuery(queryText)
+	if err != nil {
+		writeError(w, r, err, CodeInvalidQuery)
+		return
+	}
+
+	// По умолчанию показываем только невыполненные задачи
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = userQuery.Status
+	}
+	if status == "" {
+		status = StatusOpen
+	}
+
+	limit := defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPageSize {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "limit"))
+			return
+		}
+		limit = n
+	}
+	var cursor pageCursor
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		var err error
+		if cursor, err = decodeCursor(v); err != nil {
+			writeAPIError(w, r, newFieldError(CodeInvalidCursor, "cursor"))
+			return
+		}
+	}
+
+	filter, err := parseTaskFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err, CodeInvalidParam)
+		return
+	}
+	order, err := parseTaskSort(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err, CodeInvalidParam)
+		return
+	}
+	// Явная сортировка заменяет порядок по релевантности при поиске
+	explicitSort := order.By != ""
+	if !explicitSort {
+		// Задачи без даты показываются в порядке добавления
+		order.By = SortDate
+		if backlog {
+			order.By = SortCreated
+		}
+	}
 
-	query := "SELECT id, date, title, comment, repeat FROM scheduler"
+	from := "scheduler"
+	snippets := "'', ''"
+	ranked := false          // Порядок по релевантности FTS5, страницы считаются сдвигом
+	rankByScore := false     // Нечёткий поиск: сходство считается в Go
+	searchInGo := false      // Поиск по словам в Go: без FTS5 или по расшифрованным задачам
+	var where []string
 	var args []interface{}
 
+	switch status {
+	case StatusOpen, StatusCompleted:
+		where = append(where, "status = ?")
+		args = append(args, status)
+	case "all":
+	default:
+		writeAPIError(w, r, newFieldError(CodeInvalidParam, "status").text(CodeInvalidParam+".enum", "open, completed, all"))
+		return
+	}
+
+	if backlog {
+		where = append(where, "date = ''")
+	} else {
+		where = append(where, "date != ''")
+	}
+
+	filterWhere, filterArgs := filter.where(time.Now().Format("20060102"))
+	where = append(where, filterWhere...)
+	args = append(args, filterArgs...)
+
+	// Текстовые условия запроса проверяются в Go, остальные - в SQL
+	queryInGo := userQuery.hasText()
+	queryWhere, queryArgs := userQuery.where(time.Now())
+	where = append(where, queryWhere...)
+	args = append(args, queryArgs...)
+
 	if search != "" {
 		if parsedDate, err := time.Parse("02.01.2006", search); err == nil {
-			query += " WHERE date = ?"
+			where = append(where, "date = ?")
 			args = append(args, parsedDate.Format("20060102"))
-		} else {
-			query += " WHERE title LIKE ? OR comment LIKE ?"
-			searchPattern := "%" + search + "%"
-			args = append(args, searchPattern, searchPattern)
+		} else if fuzzy {
+			// Нечёткий поиск: кандидатов отбирает триграммный индекс, а сходство
+			// считается в rankFuzzy. Без индекса проверяем все задачи.
+			rankByScore = true
+			if match := trigramQuery(search); ftsEnabled && !encryptionEnabled() && match != "" {
+				from += trigramJoin
+				args = append([]interface{}{match, fuzzyCandidates}, args...)
+			}
+		} else if encryptionEnabled() || !ftsEnabled {
+			// Индексы видят только шифротекст, а LIKE в SQLite не различает регистр
+			// только у латиницы, поэтому ищем по расшифрованным задачам в Go
+			searchInGo = true
+		} else if match := ftsQuery(search); match != "" {
+			// Полнотекстовый поиск: сначала самые подходящие задачи
+			from += ftsJoin
+			snippets = "title_snippet, comment_snippet"
+			ranked = !explicitSort
+			args = append([]interface{}{match}, args...)
+		}
+	}
+	// Зашифрованные заголовки SQLite сортирует по шифротексту, поэтому сортируем в Go
+	sortInGo := order.By == SortTitle && encryptTitle && encryptionEnabled()
+	inGo := rankByScore || searchInGo || queryInGo || sortInGo
+
+	// Курсор годится только для того порядка, для которого был выдан
+	cursorSort := order.String()
+	if ranked || (rankByScore && !explicitSort) {
+		cursorSort = "rank"
+	}
+	if cursor != (pageCursor{}) && cursor.Sort != cursorSort {
+		writeAPIError(w, r, newFieldError(CodeInvalidCursor, "cursor").text(CodeInvalidCursor+".sort"))
+		return
+	}
+
+	total := -1
+	if withTotal && !inGo {
+		countQuery := "SELECT COUNT(*) FROM " + from
+		if len(where) > 0 {
+			countQuery += " WHERE " + strings.Join(where, " AND ")
 		}
+		if err := db.QueryRowContext(r.Context(), countQuery, args...).Scan(&total); err != nil {
+			writeError(w, r, err, CodeStorage)
+			return
+		}
+	}
+
+	// Задачи с одинаковым значением сортировки упорядочены по ключу, поэтому порядок
+	// всегда один и тот же и курсор (значение, ключ) однозначно указывает место в списке
+	column := order.column()
+	dir, cmp := "", ">"
+	if order.Desc {
+		dir, cmp = " DESC", "<"
+	}
+	orderBy := "id" + dir
+	if column != "" {
+		orderBy = column + dir + ", " + orderBy
 	}
 
-	query += " ORDER BY date LIMIT 50"
+	// Берём на одну задачу больше страницы, чтобы знать, есть ли следующая
+	pageLimit, offset := limit+1, 0
+	switch {
+	case inGo:
+		// Отбор и порядок считаются в Go, поэтому читаем всех кандидатов
+		pageLimit = -1
+	case ranked:
+		orderBy = "match_rank, " + orderBy
+		offset = cursor.Offset
+	case cursor.Key > 0 && column != "":
+		where = append(where, "("+column+", id) "+cmp+" (?, ?)")
+		args = append(args, cursor.Value, cursor.Key)
+	case cursor.Key > 0:
+		where = append(where, "id "+cmp+" ?")
+		args = append(args, cursor.Key)
+	}
+
+	query := "SELECT " + taskColumns + ", " + snippets + " FROM " + from
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + orderBy + " LIMIT " + strconv.Itoa(pageLimit) + " OFFSET " + strconv.Itoa(offset)
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(r.Context(), query, args...)
 	if err != nil {
-		http.Error(w, `{"error":"Ошибка в базе"}`, http.StatusInternalServerError)
+		writeError(w, r, err, CodeStorage)
 		return
 	}
 	defer rows.Close()
@@ -236,19 +557,69 @@ func tasksHandler(w http.ResponseWriter, r *http.Request) {
 	var tasks []Task
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+		err := rows.Scan(&task.Key, &task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Status, &task.CompletedAt, &task.Version,
+			&task.TitleSnippet, &task.CommentSnippet)
 		if err != nil {
-			http.Error(w, `{"error":"Ошибка чтения"}`, http.StatusInternalServerError)
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		if err := prepareTask(&task); err != nil {
+			writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeEncryption).text(CodeEncryption+".decrypt"))
 			return
 		}
+		if searchInGo && !matchesSearch(task, search) {
+			continue
+		}
+		if queryInGo && !userQuery.matchText(task) {
+			continue
+		}
 		tasks = append(tasks, task)
 	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+
+	if rankByScore {
+		tasks = rankFuzzy(tasks, search)
+	}
+	if inGo {
+		if !rankByScore || explicitSort {
+			sortTasks(tasks, order)
+		}
+		// Все подходящие задачи уже в памяти: страница - это срез со сдвигом
+		offset = min(cursor.Offset, len(tasks))
+		if withTotal {
+			total = len(tasks)
+		}
+		tasks = tasks[offset:min(offset+limit+1, len(tasks))]
+	}
+
+	var next string
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		if ranked || inGo {
+			next = pageCursor{Offset: offset + limit, Sort: cursorSort}.encode()
+		} else {
+			last := tasks[limit-1]
+			key, _ := strconv.ParseInt(last.Key, 10, 64)
+			next = pageCursor{Value: order.value(last), Key: key, Sort: cursorSort}.encode()
+		}
+	}
 
 	if tasks == nil {
 		tasks = []Task{}
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks})
+	resp := map[string]interface{}{"tasks": tasks}
+	if next != "" {
+		resp["next_cursor"] = next
+	}
+	if withTotal {
+		resp["total"] = total
+	}
+	w.Header().Set("ETag", listETag(tasks))
+	json.NewEncoder(w).Encode(resp)
 }
 
 // nextDateHandler - считает следующую дату для повторения
@@ -261,13 +632,13 @@ func nextDateHandler(w http.ResponseWriter, r *http.Request) {
 
 	now, err := time.Parse("20060102", nowStr)
 	if err != nil {
-		http.Error(w, `{"error":"Ошибка в параметре now"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newFieldError(CodeInvalidParam, "now"))
 		return
 	}
 	
 	next, err := NextDateSimple(now, dateStr, repeat)
 	if err != nil {
-		http.Error(w, `{"error":"Ошибка в вычислении даты"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newFieldError(CodeInvalidRepeat, "repeat"))
 		return
 	}
 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Completion - запись о выполнении одного повторения задачи
+type Completion struct {
+	ID            string `json:"id"`
+	TaskID        string `json:"task_id"`
+	ScheduledDate string `json:"scheduled_date"` // Дата, на которую была назначена задача
+	CompletedAt   string `json:"completed_at"`   // Когда задачу реально отметили выполненной
+}
+
+// recordCompletion - сохраняет отметку о выполнении задачи
+func recordCompletion(ctx context.Context, q dbtx, taskID, scheduledDate string, completedAt time.Time) error {
+	_, err := q.ExecContext(ctx, "INSERT INTO completions (task_id, scheduled_date, completed_at) VALUES (?, ?, ?)",
+		taskID, scheduledDate, dbTime(completedAt))
+	return err
+}
+
+// historyHandler - возвращает историю выполнений задачи по ID
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+
+	// История хранится по целому ключу задачи; ищем его и в архиве.
+	// Если задачи уже нет, считаем, что передан прежний целый ID.
+	key, publicID := id, id
+	err := db.QueryRowContext(r.Context(), `SELECT id, COALESCE(uid, CAST(id AS TEXT)) FROM scheduler WHERE `+taskByID+`
+		UNION ALL SELECT id, COALESCE(uid, CAST(id AS TEXT)) FROM archive WHERE `+taskByID+` LIMIT 1`,
+		id, id, id, id).Scan(&key, &publicID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("historyHandler: ошибка поиска задачи id=%s: %v\n", id, err)
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `SELECT id, ?, scheduled_date, completed_at FROM completions
+		WHERE task_id = ? ORDER BY completed_at, id`, publicID, key)
+	if err != nil {
+		log.Printf("historyHandler: ошибка запроса id=%s: %v\n", id, err)
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	defer rows.Close()
+
+	var history []Completion
+	for rows.Next() {
+		var c Completion
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.ScheduledDate, &c.CompletedAt); err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		history = append(history, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+
+	if history == nil {
+		history = []Completion{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"history": history})
+}
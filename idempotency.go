@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour // Сколько хранится ответ на запрос с Idempotency-Key
+	maxIdempotencyKeyLen  = 255            // Длиннее ключ не принимаем
+)
+
+// idempotencyTTL - срок хранения ответов по ключам, 0 отключает ключи
+var idempotencyTTL = defaultIdempotencyTTL
+
+// idempotencyLease - сколько ключ считается занятым выполняющимся запросом.
+// Совпадает со сроком запроса: позже ответа уже не будет (сервер упал или перезапущен),
+// и повтор выполняет запрос заново. 0 - ключ занят до конца idempotencyTTL.
+var idempotencyLease = defaultRequestTimeout
+
+// idempotentHeaders - заголовки ответа, которые сохраняются и отдаются при повторе
+var idempotentHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// storedResponse - сохранённый ответ на запрос с ключом
+type storedResponse struct {
+	Status int
+	Header map[string]string
+	Body   string
+}
+
+// withIdempotency - повтор POST с тем же заголовком Idempotency-Key не выполняет
+// запрос заново, а возвращает сохранённый ответ первого. Так повтор после обрыва связи
+// не создаёт вторую задачу и не сдвигает повторяющуюся задачу ещё раз.
+// Тот же ключ с другим телом или адресом - ошибка 422, пока первый запрос
+// ещё выполняется - 409. Ответы с ошибкой сервера не сохраняются: такой запрос можно повторить.
+// Ключ освобождается и при панике в обработчике.
+func withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost || idempotencyTTL <= 0 {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "Idempotency-Key"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, err, CodeInternal)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		saved, err := reserveIdempotencyKey(r.Context(), key, requestFingerprint(r, body), time.Now())
+		if err != nil {
+			writeError(w, r, err, CodeStorage)
+			return
+		}
+		if saved != nil {
+			log.Printf("withIdempotency: повтор запроса %s %s с ключом %q\n", r.Method, r.URL.Path, key)
+			for name, value := range saved.Header {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			io.WriteString(w, saved.Body)
+			return
+		}
+
+		// Ответ сохраняем и ключ освобождаем, даже если клиент уже отключился:
+		// ради этого он и повторит запрос
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			if p := recover(); p != nil {
+				releaseIdempotencyKey(ctx, key)
+				panic(p)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		if rec.status < http.StatusInternalServerError && rec.status != statusClientClosedRequest {
+			err := saveIdempotentResponse(ctx, key, rec)
+			if err == nil {
+				return
+			}
+			log.Printf("withIdempotency: ответ для ключа %q не сохранён: %v\n", key, err)
+		}
+		releaseIdempotencyKey(ctx, key)
+	}
+}
+
+// releaseIdempotencyKey - освобождает ключ, чтобы запрос можно было повторить
+func releaseIdempotencyKey(ctx context.Context, key string) {
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = ?", key)
+		return err
+	})
+	if err != nil {
+		log.Printf("withIdempotency: ключ %q не освобождён: %v\n", key, err)
+	}
+}
+
+// validIdempotencyKey - ключ из видимых ASCII-символов не длиннее maxIdempotencyKeyLen
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint - отпечаток запроса: метод, адрес с параметрами и тело
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveIdempotencyKey - занимает ключ за запросом или возвращает сохранённый ответ.
+// Просроченные ключи удаляются здесь же, поэтому отдельная очистка не нужна.
+// Ключ без ответа старше idempotencyLease брошен, его занимает новый запрос.
+func reserveIdempotencyKey(ctx context.Context, key, fingerprint string, now time.Time) (*storedResponse, error) {
+	var saved *storedResponse
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		saved = nil
+		cutoff := dbTime(now.Add(-idempotencyTTL))
+		if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < ?", cutoff); err != nil {
+			return err
+		}
+
+		var storedFingerprint, headers, body, createdAt string
+		var status int
+		err := tx.QueryRowContext(ctx, "SELECT fingerprint, status, headers, body, created_at FROM idempotency_keys WHERE key = ?", key).
+			Scan(&storedFingerprint, &status, &headers, &body, &createdAt)
+		if err == sql.ErrNoRows {
+			_, err = tx.ExecContext(ctx, "INSERT INTO idempotency_keys (key, fingerprint, created_at) VALUES (?, ?, ?)",
+				key, fingerprint, dbTime(now))
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if storedFingerprint != fingerprint {
+			return newAPIError(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused)
+		}
+		if status == 0 {
+			reserved, err := time.Parse(time.RFC3339, createdAt)
+			if err != nil || idempotencyLease <= 0 || now.Sub(reserved) < idempotencyLease {
+				return newAPIError(http.StatusConflict, CodeIdempotencyInProgress)
+			}
+			log.Printf("reserveIdempotencyKey: запрос с ключом %q не завершился, выполняем заново\n", key)
+			_, err = tx.ExecContext(ctx, "UPDATE idempotency_keys SET created_at = ? WHERE key = ?", dbTime(now), key)
+			return err
+		}
+
+		saved = &storedResponse{Status: status}
+		if err := json.Unmarshal([]byte(headers), &saved.Header); err != nil {
+			return err
+		}
+		// Тело может содержать задачу, поэтому при включённом шифровании хранится зашифрованным
+		if saved.Body, err = decryptField(body); err != nil {
+			return newAPIError(http.StatusInternalServerError, CodeEncryption).text(CodeEncryption + ".decrypt")
+		}
+		return nil
+	})
+	return saved, err
+}
+
+// saveIdempotentResponse - записывает ответ на запрос под его ключом
+func saveIdempotentResponse(ctx context.Context, key string, rec *responseRecorder) error {
+	header := map[string]string{}
+	for _, name := range idempotentHeaders {
+		if value := rec.Header().Get(name); value != "" {
+			header[name] = value
+		}
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	body, err := encryptField(rec.body.String())
+	if err != nil {
+		return err
+	}
+
+	return withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE idempotency_keys SET status = ?, headers = ?, body = ? WHERE key = ?",
+			rec.status, string(headers), body, key)
+		return err
+	})
+}
+
+// responseRecorder - пишет ответ клиенту и запоминает его код и тело
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
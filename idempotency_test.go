@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	openTestDB(t)
+	calls := 0
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("обработчик упал")
+		}
+		w.Write([]byte(`{}`))
+	})
+
+	assert.Panics(t, func() {
+		serve(t, handler, http.MethodPost, "/api/task", `{"title":"x"}`, "Idempotency-Key", "panic-1")
+	})
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM idempotency_keys").Scan(&count))
+	assert.Zero(t, count)
+
+	// Повтор с тем же ключом выполняется, а не получает 409
+	rec := serve(t, handler, http.MethodPost, "/api/task", `{"title":"x"}`, "Idempotency-Key", "panic-1")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, 2, calls)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -45,9 +46,26 @@ func main() {
 	}
 	fmt.Println("Путь к базе данных:", dbFile)
 
+	// Восстановление из снимка: ./go_final_project restore <файл>
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if len(os.Args) < 3 {
+			log.Fatal("Укажите файл снимка: restore <файл>")
+		}
+		if err := restoreBackup(os.Args[2], dbFile); err != nil {
+			log.Fatal("Ошибка восстановления: ", err)
+		}
+		fmt.Println("База восстановлена из", os.Args[2])
+		return
+	}
+
+	// Режим обслуживания: TODO_MAINTENANCE=1 запрещает изменения с самого запуска,
+	// TODO_DB_READONLY=1 ещё и открывает файл базы только для чтения
+	dbReadOnly = os.Getenv("TODO_DB_READONLY") == "1"
+	setMaintenance(dbReadOnly || os.Getenv("TODO_MAINTENANCE") == "1", "запуск")
+
 	// Открываем базу данных
 	var err error
-	db, err = sql.Open("sqlite3", dbFile)
+	db, err = sql.Open("sqlite3", dataSourceName(dbFile, dbReadOnly))
 	if err != nil {
 		log.Fatal("Ошибка открытия базы: ", err)
 	}
@@ -59,10 +77,14 @@ func main() {
 
 	// Проверяем, есть ли таблица scheduler
 	var tableName string
-	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='scheduler'").Scan(&tableName)
-	if err == sql.ErrNoRows {
-		// Если таблицы нет, создаём её
-		_, err = db.Exec(`
+	if dbReadOnly {
+		// Схему менять нельзя: работаем с базой как есть, поиск идёт без индекса FTS5
+		fmt.Println("База открыта только для чтения, обновление схемы пропущено")
+	} else {
+		err = db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='scheduler'").Scan(&tableName)
+		if err == sql.ErrNoRows {
+			// Если таблицы нет, создаём её
+			_, err = db.Exec(`
             CREATE TABLE scheduler (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 date TEXT NOT NULL,
@@ -72,28 +94,135 @@ func main() {
             );
             CREATE INDEX idx_date ON scheduler (date);
         `)
-		if err != nil {
-			log.Fatal("Ошибка создания таблицы: ", err)
+			if err != nil {
+				log.Fatal("Ошибка создания таблицы: ", err)
+			}
+			fmt.Println("Таблица scheduler создана")
+		} else if err != nil {
+			log.Fatal("Ошибка проверки таблицы: ", err)
+		} else {
+			fmt.Println("Таблица scheduler уже есть")
+		}
+
+		// Обновляем схему базы до актуальной
+		if err = migrateDB(); err != nil {
+			log.Fatal("Ошибка обновления схемы базы: ", err)
 		}
-		fmt.Println("Таблица scheduler создана")
-	} else if err != nil {
-		log.Fatal("Ошибка проверки таблицы: ", err)
-	} else {
-		fmt.Println("Таблица scheduler уже есть")
 	}
 
+	// Шифрование комментариев, если задан ключ
+	if err = initEncryption(); err != nil {
+		log.Fatal("Ошибка настройки шифрования: ", err)
+	}
+
+	// Смена ключа шифрования: ./go_final_project rotate-key
+	if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+		if err := rotateEncryptionKey(); err != nil {
+			log.Fatal("Ошибка смены ключа: ", err)
+		}
+		db.Close()
+		fmt.Println("Данные перешифрованы текущим ключом")
+		return
+	}
+
+	// Проверка запросов по описанию API подключается при настройке маршрутов
+	validateRequests = os.Getenv("TODO_VALIDATE_REQUESTS") == "1"
+
 	// Настраиваем маршруты для HTTP
-	http.Handle("/", http.FileServer(http.Dir(webDir))) // Статические файлы (без пароля)
-	http.HandleFunc("/api/signin", signinHandler)       // Вход без проверки токена
+	http.Handle("/", http.FileServer(http.Dir(webDir)))           // Статические файлы (без пароля)
+	http.HandleFunc("/api/", apiNotFoundHandler)                  // Неизвестные адреса API отвечают ошибкой в JSON
+	http.HandleFunc("/api/signin", withValidation(signinHandler)) // Вход без проверки токена
+	http.HandleFunc("/api/openapi.json", openAPIHandler)          // Описание API тоже без токена
 	// Защищённые маршруты с проверкой токена
 	http.HandleFunc("/api/nextdate", authMiddleware(nextDateHandler))
-	http.HandleFunc("/api/task", authMiddleware(taskHandler))
+	http.HandleFunc("/api/task", authMiddleware(withIdempotency(taskHandler)))
 	http.HandleFunc("/api/tasks", authMiddleware(tasksHandler))
-	http.HandleFunc("/api/task/done", authMiddleware(doneTaskHandler))
+	http.HandleFunc("/api/tasks/batch", authMiddleware(batchHandler))
+	http.HandleFunc("/api/task/done", authMiddleware(withIdempotency(doneTaskHandler)))
+	http.HandleFunc("/api/task/undone", authMiddleware(undoneTaskHandler))
+	http.HandleFunc("/api/task/schedule", authMiddleware(scheduleTaskHandler))
+	http.HandleFunc("/api/task/history", authMiddleware(historyHandler))
+	http.HandleFunc("/api/audit", authMiddleware(auditHandler))
+	http.HandleFunc("/api/audit/revert", authMiddleware(auditRevertHandler))
+	http.HandleFunc("/api/admin/backup", authMiddleware(backupHandler))
+	http.HandleFunc("/api/archive", authMiddleware(archiveHandler))
+	http.HandleFunc("/api/views", authMiddleware(viewsHandler))
+	http.HandleFunc("/api/admin/maintenance", authMiddleware(maintenanceHandler))
+	// API v2 с ID задачи в пути
+	registerV2Routes(http.DefaultServeMux)
+
+	// Описание API должно совпадать с маршрутами
+	if err = loadOpenAPI(); err != nil {
+		log.Fatal("Ошибка описания API: ", err)
+	}
+	if err = checkOpenAPIRoutes(http.DefaultServeMux); err != nil {
+		log.Fatal("Описание API не совпадает с маршрутами: ", err)
+	}
+
+	// SIGUSR1 включает и выключает режим обслуживания
+	go watchMaintenanceSignal()
+
+	// Фоновые задачи останавливаются вместе с сервером
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Снимки базы по расписанию, если указана папка
+	if backupDir := os.Getenv("TODO_BACKUP_DIR"); backupDir != "" {
+		interval := defaultBackupInterval
+		if v := os.Getenv("TODO_BACKUP_INTERVAL"); v != "" {
+			if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+				log.Fatal("Неправильный TODO_BACKUP_INTERVAL: ", v)
+			}
+		}
+		keep := defaultBackupKeep
+		if v := os.Getenv("TODO_BACKUP_KEEP"); v != "" {
+			if keep, err = strconv.Atoi(v); err != nil || keep <= 0 {
+				log.Fatal("Неправильный TODO_BACKUP_KEEP: ", v)
+			}
+		}
+		go runBackups(jobsCtx, backupDir, interval, keep)
+	}
+
+	// Архивация и очистка старых данных, 0 в днях отключает правило
+	policy := retentionPolicy{archiveAfterDays: defaultArchiveAfterDays, purgeAfterDays: defaultPurgeAfterDays}
+	if v := os.Getenv("TODO_ARCHIVE_AFTER_DAYS"); v != "" {
+		if policy.archiveAfterDays, err = strconv.Atoi(v); err != nil || policy.archiveAfterDays < 0 {
+			log.Fatal("Неправильный TODO_ARCHIVE_AFTER_DAYS: ", v)
+		}
+	}
+	if v := os.Getenv("TODO_PURGE_AFTER_DAYS"); v != "" {
+		if policy.purgeAfterDays, err = strconv.Atoi(v); err != nil || policy.purgeAfterDays < 0 {
+			log.Fatal("Неправильный TODO_PURGE_AFTER_DAYS: ", v)
+		}
+	}
+	retentionInterval := defaultRetentionInterval
+	if v := os.Getenv("TODO_RETENTION_INTERVAL"); v != "" {
+		if retentionInterval, err = time.ParseDuration(v); err != nil || retentionInterval <= 0 {
+			log.Fatal("Неправильный TODO_RETENTION_INTERVAL: ", v)
+		}
+	}
+	if policy.archiveAfterDays > 0 || policy.purgeAfterDays > 0 {
+		go runRetention(jobsCtx, policy, retentionInterval)
+	}
+
+	// Сколько хранятся ответы на запросы с Idempotency-Key, 0 отключает ключи
+	idempotencyTTL = durationFromEnv("TODO_IDEMPOTENCY_TTL", defaultIdempotencyTTL)
+
+	// Сроки для соединений и запросов, 0 отключает ограничение
+	readTimeout := durationFromEnv("TODO_READ_TIMEOUT", defaultReadTimeout)
+	writeTimeout := durationFromEnv("TODO_WRITE_TIMEOUT", defaultWriteTimeout)
+	idleTimeout := durationFromEnv("TODO_IDLE_TIMEOUT", defaultIdleTimeout)
+	requestTimeout := durationFromEnv("TODO_REQUEST_TIMEOUT", defaultRequestTimeout)
+	idempotencyLease = requestTimeout
 
 	// Создаём сервер
 	srv := &http.Server{
-		Addr: port,
+		Addr:              port,
+		Handler:           withMaintenance(withDeadline(http.DefaultServeMux, requestTimeout)),
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
 	}
 
 	// Запускаем сервер в отдельной горутине
@@ -116,8 +245,23 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Println("Ошибка при остановке: ", err)
 	}
+	stopJobs()
 	if err := db.Close(); err != nil {
 		log.Println("Ошибка закрытия базы: ", err)
 	}
 	fmt.Println("Сервер остановлен")
 }
+
+// durationFromEnv - читает длительность из переменной окружения (например, "30s").
+// Если переменной нет, возвращает def; 0 означает "без ограничения".
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatal("Неправильный "+name+": ", v)
+	}
+	return d
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Тесты в этом пакете проверяют то, что нельзя проверить через запущенный сервер
+// из tests: шифрование, снимки, сроки хранения, сроки запросов. Каждый тест
+// работает со своей базой во временной папке.
+
+// openTestDB - подменяет глобальную db чистой базой с актуальной схемой и возвращает путь к файлу
+func openTestDB(t *testing.T) string {
+	t.Helper()
+	prev := db
+	path := filepath.Join(t.TempDir(), dbFileName)
+	var err error
+	db, err = sql.Open("sqlite3", dataSourceName(path, false))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		db = prev
+	})
+
+	_, err = db.Exec(`
+        CREATE TABLE scheduler (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            date TEXT NOT NULL,
+            title TEXT NOT NULL,
+            comment TEXT,
+            repeat TEXT CHECK (length(repeat) <= 128)
+        );
+        CREATE INDEX idx_date ON scheduler (date);
+    `)
+	require.NoError(t, err)
+	require.NoError(t, migrateDB())
+	return path
+}
+
+// useTestKey - включает шифрование ключом secret на время теста
+func useTestKey(t *testing.T, secret string, old ...string) {
+	t.Helper()
+	prevKey, prevOld, prevTitle := fieldKey, oldFieldKeys, encryptTitle
+	t.Cleanup(func() {
+		fieldKey, oldFieldKeys, encryptTitle = prevKey, prevOld, prevTitle
+	})
+
+	var err error
+	fieldKey, err = newFieldCipher(secret)
+	require.NoError(t, err)
+	oldFieldKeys = nil
+	for _, o := range old {
+		c, err := newFieldCipher(o)
+		require.NoError(t, err)
+		oldFieldKeys = append(oldFieldKeys, c)
+	}
+}
+
+// serve - выполняет запрос обработчиком без сети. body кодируется в JSON, если это не строка.
+func serve(t *testing.T, h http.Handler, method, target string, body any, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeJSON - тело ответа как JSON-объект
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m), rec.Body.String())
+	return m
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	maintenance atomic.Bool // Режим обслуживания: чтение работает, изменения запрещены
+	dbReadOnly  bool        // База открыта только для чтения, режим обслуживания не выключается
+)
+
+// maintenanceExempt - маршруты, которые работают в режиме обслуживания при любом методе
+var maintenanceExempt = map[string]bool{
+	"/api/signin":            true, // Вход ничего не пишет в базу
+	"/api/admin/maintenance": true, // Иначе режим нельзя было бы выключить
+}
+
+// setMaintenance - включает или выключает режим обслуживания
+func setMaintenance(enabled bool, source string) {
+	if maintenance.Swap(enabled) != enabled {
+		log.Printf("setMaintenance: режим обслуживания %v (%s)\n", enabled, source)
+	}
+}
+
+// withMaintenance - в режиме обслуживания отвечает 503 на все запросы, кроме GET и HEAD
+func withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maintenance.Load() && r.Method != http.MethodGet && r.Method != http.MethodHead && !maintenanceExempt[r.URL.Path] {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.Header().Set("Retry-After", "60")
+			writeAPIError(w, r, newAPIError(http.StatusServiceUnavailable, CodeMaintenance))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// watchMaintenanceSignal - переключает режим обслуживания по сигналу SIGUSR1
+func watchMaintenanceSignal() {
+	toggle := make(chan os.Signal, 1)
+	signal.Notify(toggle, syscall.SIGUSR1)
+	for range toggle {
+		if dbReadOnly {
+			log.Println("watchMaintenanceSignal: база открыта только для чтения, режим не меняется")
+			continue
+		}
+		setMaintenance(!maintenance.Load(), "SIGUSR1")
+	}
+}
+
+// maintenanceHandler - GET возвращает состояние режима обслуживания,
+// POST с {"enabled": true|false} включает или выключает его
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON).text(CodeInvalidJSON+".enabled"))
+			return
+		}
+		if dbReadOnly && !*req.Enabled {
+			writeAPIError(w, r, newAPIError(http.StatusConflict, CodeReadOnly))
+			return
+		}
+		setMaintenance(*req.Enabled, "POST /api/admin/maintenance")
+	default:
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{
+		"maintenance": maintenance.Load(),
+		"read_only":   dbReadOnly,
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Языки сообщений API
+const (
+	LangRU      = "ru"
+	LangEN      = "en"
+	defaultLang = LangRU
+)
+
+// langKey - ключ для языка, который пользователь выбрал при входе
+const langKey contextKey = "lang"
+
+// messages - тексты ошибок по ключу сообщения и языку.
+// Ключ - код ошибки или код с уточнением через точку, когда одному коду нужны разные тексты.
+// {field} заменяется на поле ошибки, %s и %d - на аргументы сообщения.
+var messages = map[string]map[string]string{
+	// Запрос
+	CodeInvalidJSON:              {LangRU: "Ошибка в JSON", LangEN: "Invalid JSON"},
+	CodeInvalidJSON + ".patch":   {LangRU: "Ожидается JSON-объект с изменяемыми полями", LangEN: "Expected a JSON object with the fields to change"},
+	CodeInvalidJSON + ".enabled": {LangRU: `Ожидается {"enabled": true или false}`, LangEN: `Expected {"enabled": true or false}`},
+	CodeNotFound:                 {LangRU: "Нет такого адреса API", LangEN: "No such API endpoint"},
+	CodeMethodNotAllowed:         {LangRU: "Метод не поддерживается", LangEN: "Method not allowed"},
+	CodeIDRequired:               {LangRU: "ID не указан", LangEN: "ID is required"},
+	CodeIDMismatch:               {LangRU: "ID в теле не совпадает с ID в запросе", LangEN: "ID in the body does not match ID in the URL"},
+	CodeInvalidParam:             {LangRU: "Неправильное значение параметра {field}", LangEN: "Invalid value of parameter {field}"},
+	CodeInvalidParam + ".date":   {LangRU: "Неправильная дата в параметре {field}", LangEN: "Invalid date in parameter {field}"},
+	CodeInvalidParam + ".enum":   {LangRU: "Параметр {field} принимает %s", LangEN: "Parameter {field} accepts %s"},
+	CodeInvalidCursor:            {LangRU: "Неправильный курсор", LangEN: "Invalid cursor"},
+	CodeInvalidCursor + ".sort":  {LangRU: "Курсор выдан для другой сортировки", LangEN: "The cursor was issued for a different sort order"},
+	CodeInvalidQuery:             {LangRU: "Ошибка в запросе", LangEN: "Invalid query"},
+	CodeInvalidQuery + ".empty":  {LangRU: "Ошибка в запросе: пустое условие %s", LangEN: "Invalid query: empty condition %s"},
+	CodeInvalidQuery + ".form":   {LangRU: "Ошибка в запросе: для %[1]s нужен вид %[1]s:текст", LangEN: "Invalid query: use %[1]s:text"},
+	CodeInvalidQuery + ".quote":  {LangRU: "Ошибка в запросе: не закрыта кавычка", LangEN: "Invalid query: unclosed quote"},
+	CodeInvalidQuery + ".date":   {LangRU: "Ошибка в запросе: неправильная дата %s", LangEN: "Invalid query: invalid date %s"},
+	CodeInvalidQuery + ".enum":   {LangRU: "Ошибка в запросе: %s принимает %s", LangEN: "Invalid query: %s accepts %s"},
+	CodeInvalidQuery + ".negate": {LangRU: "Ошибка в запросе: %s нельзя исключить", LangEN: "Invalid query: %s cannot be negated"},
+	CodeInvalidBatch:             {LangRU: "Нет операций", LangEN: "No operations"},
+	CodeInvalidBatch + ".size":   {LangRU: "Не больше %d операций за запрос", LangEN: "At most %d operations per request"},
+	CodeInvalidBatch + ".op":     {LangRU: "Неизвестная операция %s", LangEN: "Unknown operation %s"},
+	CodeFieldRequired:            {LangRU: "Не заполнено поле {field}", LangEN: "Field {field} is required"},
+	CodeTitleRequired:            {LangRU: "Заголовок обязателен", LangEN: "Title is required"},
+	CodeInvalidDate:              {LangRU: "Неправильная дата", LangEN: "Invalid date"},
+	CodeInvalidDate + ".backlog": {LangRU: "У задачи из бэклога не может быть даты", LangEN: "A backlog task cannot have a date"},
+	CodeInvalidRepeat:            {LangRU: "Ошибка в правиле повторения", LangEN: "Invalid repeat rule"},
+	CodeInvalidRepeat + ".days":  {LangRU: "Для 'd' нужно указать число дней от 1 до 400", LangEN: "'d' needs a number of days from 1 to 400"},
+	CodeInvalidRepeat + ".kind":  {LangRU: "Неподдерживаемое правило", LangEN: "Unsupported repeat rule"},
+	CodeRepeatNeedsDate:          {LangRU: "Для повторяющейся задачи нужна дата", LangEN: "A recurring task needs a date"},
+	CodeInvalidField:             {LangRU: "Неправильное значение поля {field}", LangEN: "Invalid value of field {field}"},
+	CodeReadOnlyField:            {LangRU: "Поле {field} нельзя изменить через PATCH", LangEN: "Field {field} cannot be changed with PATCH"},
+	CodeUnknownField:             {LangRU: "Неизвестное поле {field}", LangEN: "Unknown field {field}"},
+	CodeTaskNotFound:             {LangRU: "Задача не найдена", LangEN: "Task not found"},
+	CodeViewNotFound:             {LangRU: "Список не найден", LangEN: "View not found"},
+	CodeAuditNotFound:            {LangRU: "Запись журнала не найдена", LangEN: "Audit log entry not found"},
+	CodeVersionMismatch:          {LangRU: "Задача изменилась, обновите её", LangEN: "The task has changed, reload it"},
+	CodeAlreadyCompleted:         {LangRU: "Задача уже выполнена", LangEN: "The task is already completed"},
+	CodeNotCompleted:             {LangRU: "Задача не выполнена", LangEN: "The task is not completed"},
+	CodeAlreadyScheduled:         {LangRU: "Задача уже запланирована", LangEN: "The task is already scheduled"},
+	CodeViewNameTaken:            {LangRU: "Список с таким названием уже есть", LangEN: "A view with this name already exists"},
+	CodeCannotRevert:             {LangRU: "Нельзя откатить создание задачи", LangEN: "Task creation cannot be reverted"},
+	CodeTaskArchived:             {LangRU: "Задача в архиве, её изменения не откатываются", LangEN: "The task is archived, its changes cannot be reverted"},
+	CodeIdempotencyKeyReused:     {LangRU: "Ключ Idempotency-Key уже использован для другого запроса", LangEN: "The Idempotency-Key was already used for a different request"},
+	CodeIdempotencyInProgress:    {LangRU: "Запрос с этим Idempotency-Key ещё выполняется", LangEN: "A request with this Idempotency-Key is still in progress"},
+	CodeAuthRequired:             {LangRU: "Требуется авторизация", LangEN: "Authentication required"},
+	CodeInvalidPassword:          {LangRU: "Неправильный пароль", LangEN: "Wrong password"},
+	CodeMaintenance:              {LangRU: "Идут технические работы, изменения временно недоступны", LangEN: "Maintenance in progress, changes are temporarily unavailable"},
+	CodeReadOnly:                 {LangRU: "База открыта только для чтения", LangEN: "The database is read-only"},
+	CodeTimeout:                  {LangRU: "Сервер не успел обработать запрос, попробуйте позже", LangEN: "The server did not finish the request in time, try again later"},
+	CodeCanceled:                 {LangRU: "Запрос отменён", LangEN: "Request canceled"},
+	CodeEncryption:               {LangRU: "Не получилось зашифровать задачу", LangEN: "Could not encrypt the task"},
+	CodeEncryption + ".decrypt":  {LangRU: "Не получилось расшифровать задачу", LangEN: "Could not decrypt the task"},
+	CodeBackup:                   {LangRU: "Не получилось сделать копию", LangEN: "Could not make a backup"},
+	CodeStorage:                  {LangRU: "Ошибка в базе", LangEN: "Database error"},
+	CodeStorage + ".read":        {LangRU: "Ошибка чтения", LangEN: "Read error"},
+	CodeStorage + ".create":      {LangRU: "Не получилось добавить задачу", LangEN: "Could not add the task"},
+	CodeStorage + ".update":      {LangRU: "Ошибка обновления", LangEN: "Update failed"},
+	CodeStorage + ".delete":      {LangRU: "Ошибка удаления", LangEN: "Delete failed"},
+	CodeStorage + ".view":        {LangRU: "Ошибка сохранения списка", LangEN: "Could not save the view"},
+	CodeStorage + ".batch":       {LangRU: "Ошибка выполнения пакета", LangEN: "The batch failed"},
+	CodeInternal:                 {LangRU: "Внутренняя ошибка", LangEN: "Internal error"},
+	CodeInternal + ".token":      {LangRU: "Не могу создать токен", LangEN: "Could not create a token"},
+	CodeInternal + ".task_date":  {LangRU: "Некорректная дата задачи", LangEN: "The task has an invalid date"},
+}
+
+// message - текст сообщения key на языке lang.
+// Если перевода нет, берётся русский текст, если нет и его - сам ключ.
+func message(key, lang, field string, args ...any) string {
+	texts := messages[key]
+	text, ok := texts[lang]
+	if !ok {
+		text, ok = texts[defaultLang]
+	}
+	if !ok {
+		text = key
+	}
+	text = strings.ReplaceAll(text, "{field}", field)
+	if len(args) > 0 {
+		text = fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// supportedLang - поддерживается ли язык сообщений
+func supportedLang(lang string) bool {
+	return lang == LangRU || lang == LangEN
+}
+
+// requestLang - язык ответа: выбранный при входе, иначе первый подходящий
+// из Accept-Language, иначе русский
+func requestLang(r *http.Request) string {
+	if r == nil {
+		return defaultLang
+	}
+	if lang, _ := r.Context().Value(langKey).(string); supportedLang(lang) {
+		return lang
+	}
+	return acceptLang(r.Header.Get("Accept-Language"))
+}
+
+// acceptLang - выбирает язык из заголовка Accept-Language с учётом весов q
+func acceptLang(header string) string {
+	best, bestQ := defaultLang, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		// en-US, en_GB и EN считаются английским
+		lang := strings.ToLower(tag)
+		if i := strings.IndexAny(lang, "-_"); i >= 0 {
+			lang = lang[:i]
+		}
+		if !supportedLang(lang) {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// withLang - запоминает в контексте язык, выбранный пользователем
+func withLang(ctx context.Context, lang string) context.Context {
+	if !supportedLang(lang) {
+		return ctx
+	}
+	return context.WithValue(ctx, langKey, lang)
+}
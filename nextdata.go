@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -28,69 +26,20 @@ func NextDateSimple(now time.Time, startDate string, repeat string) (string, err
 	}
 	log.Printf("NextDateSimple: распарсенная date=%v\n", date)
 
-	// Проверяем правило повторения
-	if repeat == "" {
-		log.Println("NextDateSimple: правило повторения не указано")
-		return "", fmt.Errorf("правило повторения не указано")
-	}
-
-	parts := strings.Fields(repeat)
-	if len(parts) < 1 {
-		log.Printf("NextDateSimple: неверный формат правила, parts=%v\n", parts)
-		return "", fmt.Errorf("неверный формат правила")
-	}
-	log.Printf("NextDateSimple: parts=%v\n", parts)
-
-	// Вычисляем следующую дату
-	next := date
-	switch parts[0] {
-	case RepeatYearly:
-		// Делаем один шаг на год
-		next = next.AddDate(1, 0, 0)
-		log.Printf("NextDateSimple: после первого шага 'y', next=%v\n", next)
-		// Корректируем високосный 29 февраля
-		if next.Day() == 29 && next.Month() == time.February && !isLeapYear(next.Year()) {
-			next = time.Date(next.Year(), time.March, 1, 0, 0, 0, 0, time.UTC)
-			log.Printf("NextDateSimple: корректировка високосного года, next=%v\n", next)
-		}
-		// Если результат меньше или равен now, продолжаем итерацию
-		for next.Before(now) || next.Equal(now) {
-			log.Printf("NextDateSimple: next=%v меньше или равен now=%v, делаем шаг\n", next, now)
-			next = next.AddDate(1, 0, 0)
-			if next.Day() == 29 && next.Month() == time.February && !isLeapYear(next.Year()) {
-				next = time.Date(next.Year(), time.March, 1, 0, 0, 0, 0, time.UTC)
-				log.Printf("NextDateSimple: корректировка високосного года в цикле, next=%v\n", next)
-			}
-		}
-		log.Printf("NextDateSimple: итоговая дата для 'y', next=%v\n", next)
-		return next.Format("20060102"), nil
-
-	case RepeatDaily:
-		if len(parts) < 2 {
-			log.Println("NextDateSimple: для 'd' не указаны дни")
-			return "", fmt.Errorf("для 'd' нужно указать дни")
-		}
-		days, err := strconv.Atoi(parts[1])
-		if err != nil || days <= 0 || days > 400 {
-			log.Printf("NextDateSimple: неправильное число дней, parts[1]=%s, err=%v\n", parts[1], err)
-			return "", fmt.Errorf("неправильное число дней: %s", parts[1])
-		}
-		log.Printf("NextDateSimple: days=%d\n", days)
-		// Делаем один шаг на days дней
-		next = next.AddDate(0, 0, days)
-		log.Printf("NextDateSimple: после первого шага 'd', next=%v\n", next)
-		// Если результат меньше или равен now, продолжаем итерацию
-		for next.Before(now) || next.Equal(now) {
-			log.Printf("NextDateSimple: next=%v меньше или равен now=%v, делаем шаг\n", next, now)
-			next = next.AddDate(0, 0, days)
-		}
-		log.Printf("NextDateSimple: итоговая дата для 'd', next=%v\n", next)
-		return next.Format("20060102"), nil
+	// Проверяем правило повторения тем же разбором, что и при записи задачи
+	rule, err := parseRepeat(repeat)
+	if err != nil {
+		log.Printf("NextDateSimple: неправильное правило %q: %v\n", repeat, err)
+		return "", err
+	}
 
-	default:
-		log.Printf("NextDateSimple: неподдерживаемое правило: %s\n", parts[0])
-		return "", fmt.Errorf("неподдерживаемое правило: %s", parts[0])
+	// Делаем шаги правила, пока дата не станет больше now
+	next := rule.next(date)
+	for next.Before(now) || next.Equal(now) {
+		next = rule.next(next)
 	}
+	log.Printf("NextDateSimple: итоговая дата next=%v\n", next)
+	return next.Format("20060102"), nil
 }
 
 // doneTaskHandler обрабатывает запрос на выполнение задачи
@@ -101,7 +50,7 @@ func doneTaskHandler(w http.ResponseWriter, r *http.Request) {
 	// Проверяем метод
 	if r.Method != http.MethodPost {
 		log.Println("doneTaskHandler: метод не POST")
-		http.Error(w, `{"error":"Метод не поддерживается"}`, http.StatusMethodNotAllowed)
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
 		return
 	}
 
@@ -109,101 +58,166 @@ func doneTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		log.Println("doneTaskHandler: ID не указан")
-		http.Error(w, `{"error":"ID не указан"}`, http.StatusBadRequest)
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
 		return
 	}
 	log.Printf("doneTaskHandler: id=%s\n", id)
 
+	// Чтение задачи и её изменение идут в одной транзакции BEGIN IMMEDIATE,
+	// поэтому два одновременных запроса не сдвинут задачу дважды от одной даты
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = completeTask(tx, r, id, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		log.Printf("doneTaskHandler: задача id=%s не выполнена: %v\n", id, err)
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(after.Version))
+	w.Write([]byte(`{}`))
+}
+
+// completeTask отмечает задачу выполненной внутри транзакции и возвращает её новое состояние.
+// Разовая задача получает статус completed, повторяющаяся переносится на один шаг вперёд.
+// match - ожидаемая версия в формате If-Match, пустая строка - любая.
+func completeTask(tx *sql.Tx, r *http.Request, id, match string) (*Task, error) {
 	// Запрашиваем задачу из базы
-	var task struct {
-		ID      string
-		Date    string
-		Title   string
-		Comment string
-		Repeat  string
-	}
-	err := db.QueryRow("SELECT id, date, title, comment, repeat FROM scheduler WHERE id = ?", id).
-		Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	ctx := r.Context()
+	task, err := loadTask(ctx, tx, id)
 	if err == sql.ErrNoRows {
-		log.Printf("doneTaskHandler: задача с id=%s не найдена\n", id)
-		http.Error(w, `{"error":"Задача не найдена"}`, http.StatusNotFound)
-		return
+		return nil, newAPIError(http.StatusNotFound, CodeTaskNotFound)
 	} else if err != nil {
-		log.Printf("doneTaskHandler: ошибка базы данных при запросе id=%s: %v\n", id, err)
-		http.Error(w, `{"error":"Ошибка базы данных"}`, http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	log.Printf("doneTaskHandler: найдена задача: %+v\n", task)
+	log.Printf("completeTask: найдена задача: %+v\n", task)
+	if task.Status == StatusCompleted {
+		return nil, newAPIError(http.StatusConflict, CodeAlreadyCompleted)
+	}
+	if !matchETag(match, task.Version) {
+		return nil, newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
+	}
+	completedAt := time.Now()
 
 	// Обрабатываем в зависимости от repeat
 	if task.Repeat == "" {
-		// Удаляем задачу
-		log.Printf("doneTaskHandler: repeat пустой, удаляем задачу id=%s\n", id)
-		_, err := db.Exec("DELETE FROM scheduler WHERE id = ?", id)
-		if err != nil {
-			log.Printf("doneTaskHandler: ошибка удаления id=%s: %v\n", id, err)
-			http.Error(w, `{"error":"Ошибка удаления"}`, http.StatusInternalServerError)
-			return
+		// Отмечаем задачу выполненной, но не удаляем
+		log.Printf("completeTask: repeat пустой, отмечаем задачу id=%s выполненной\n", id)
+		_, err = tx.ExecContext(ctx, "UPDATE scheduler SET status = ?, completed_at = ?, version = version + 1 WHERE id = ?",
+			StatusCompleted, dbTime(completedAt), task.Key)
+	} else {
+		var nextDate string
+		if nextDate, err = nextOccurrence(task.Date, task.Repeat); err != nil {
+			return nil, err
 		}
-		log.Printf("doneTaskHandler: задача id=%s удалена\n", id)
-		w.Write([]byte(`{}`))
-		return
+		log.Printf("completeTask: обновляем задачу id=%s с новой датой %s\n", id, nextDate)
+		_, err = tx.ExecContext(ctx, "UPDATE scheduler SET date = ?, version = version + 1 WHERE id = ?", nextDate, task.Key)
+	}
+	if err != nil {
+		return nil, err
 	}
 
+	// Запоминаем, на какую дату задача была назначена и когда её выполнили
+	if err := recordCompletion(ctx, tx, task.Key, task.Date, completedAt); err != nil {
+		return nil, err
+	}
+	after, err := loadTask(ctx, tx, task.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, r, AuditDone, task.Key, task, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// nextOccurrence вычисляет следующую дату задачи от её текущей даты (ровно один шаг)
+func nextOccurrence(date, repeat string) (string, error) {
 	// Парсим текущую дату задачи
-	currentDate, err := time.Parse("20060102", task.Date)
+	currentDate, err := time.Parse("20060102", date)
 	if err != nil {
-		log.Printf("doneTaskHandler: некорректная дата задачи id=%s: %v\n", id, err)
-		http.Error(w, `{"error":"Некорректная дата задачи"}`, http.StatusInternalServerError)
+		log.Printf("nextOccurrence: некорректная дата задачи %s: %v\n", date, err)
+		return "", newAPIError(http.StatusInternalServerError, CodeInternal).text(CodeInternal + ".task_date")
+	}
+
+	rule, err := parseRepeat(repeat)
+	if err != nil {
+		log.Printf("nextOccurrence: неправильное правило %q: %v\n", repeat, err)
+		return "", repeatError(err)
+	}
+	return rule.next(currentDate).Format("20060102"), nil
+}
+
+// undoneTaskHandler отменяет последнее выполнение задачи
+func undoneTaskHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	log.Printf("undoneTaskHandler: запрос %s %s\n", r.Method, r.URL.String())
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
 		return
 	}
-	log.Printf("doneTaskHandler: текущая дата задачи id=%s: %v\n", id, currentDate)
-
-	// Вычисляем следующую дату от текущей даты задачи (один шаг)
-	parts := strings.Fields(task.Repeat)
-	log.Printf("doneTaskHandler: правило повторения для id=%s: %v\n", id, parts)
-	var nextDate time.Time
-	switch parts[0] {
-	case RepeatYearly:
-		nextDate = currentDate.AddDate(1, 0, 0)
-		log.Printf("doneTaskHandler: шаг 'y' для id=%s, nextDate=%v\n", id, nextDate)
-		// Корректируем високосный 29 февраля
-		if nextDate.Day() == 29 && nextDate.Month() == time.February && !isLeapYear(nextDate.Year()) {
-			nextDate = time.Date(nextDate.Year(), time.March, 1, 0, 0, 0, 0, time.UTC)
-			log.Printf("doneTaskHandler: корректировка високосного года для id=%s, nextDate=%v\n", id, nextDate)
+
+	var after *Task
+	ctx := r.Context()
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		before, err := loadTask(ctx, tx, id)
+		if err == sql.ErrNoRows {
+			return newAPIError(http.StatusNotFound, CodeTaskNotFound)
+		} else if err != nil {
+			return err
 		}
 
-	case RepeatDaily:
-		if len(parts) < 2 {
-			log.Println("doneTaskHandler: для 'd' не указаны дни")
-			http.Error(w, `{"error":"Для 'd' нужно указать дни"}`, http.StatusBadRequest)
-			return
+		// Последняя отметка о выполнении хранит дату, на которую задача была назначена
+		var completionID, scheduledDate string
+		err = tx.QueryRowContext(ctx, `SELECT id, scheduled_date FROM completions WHERE task_id = ?
+			ORDER BY completed_at DESC, id DESC LIMIT 1`, before.Key).Scan(&completionID, &scheduledDate)
+		if err != nil && err != sql.ErrNoRows {
+			return err
 		}
-		days, err := strconv.Atoi(parts[1])
-		if err != nil || days <= 0 || days > 400 {
-			log.Printf("doneTaskHandler: неправильное число дней для id=%s, parts[1]=%s: %v\n", id, parts[1], err)
-			http.Error(w, `{"error":"Неправильное число дней"}`, http.StatusBadRequest)
-			return
+
+		switch {
+		case before.Status == StatusCompleted:
+			// Разовая задача снова становится открытой
+			_, err = tx.ExecContext(ctx, "UPDATE scheduler SET status = ?, completed_at = NULL, version = version + 1 WHERE id = ?",
+				StatusOpen, before.Key)
+		case before.Repeat != "" && completionID != "":
+			// Повторяющуюся задачу возвращаем на дату последнего выполнения
+			_, err = tx.ExecContext(ctx, "UPDATE scheduler SET date = ?, version = version + 1 WHERE id = ?", scheduledDate, before.Key)
+		default:
+			return newAPIError(http.StatusConflict, CodeNotCompleted)
+		}
+		if err != nil {
+			return err
 		}
-		log.Printf("doneTaskHandler: days=%d для id=%s\n", days, id)
-		nextDate = currentDate.AddDate(0, 0, days)
-		log.Printf("doneTaskHandler: шаг 'd' для id=%s, nextDate=%v\n", id, nextDate)
-	default:
-		log.Printf("doneTaskHandler: неподдерживаемое правило для id=%s: %s\n", id, parts[0])
-		http.Error(w, `{"error":"Неподдерживаемое правило"}`, http.StatusBadRequest)
-		return
-	}
 
-	// Обновляем задачу
-	log.Printf("doneTaskHandler: обновляем задачу id=%s с новой датой %s\n", id, nextDate.Format("20060102"))
-	_, err = db.Exec("UPDATE scheduler SET date = ? WHERE id = ?", nextDate.Format("20060102"), id)
+		if completionID != "" {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM completions WHERE id = ?", completionID); err != nil {
+				return err
+			}
+		}
+		if after, err = loadTask(ctx, tx, before.Key); err != nil {
+			return err
+		}
+		return writeAudit(tx, r, AuditUndone, before.Key, before, after)
+	})
 	if err != nil {
-		log.Printf("doneTaskHandler: ошибка обновления id=%s: %v\n", id, err)
-		http.Error(w, `{"error":"Ошибка обновления"}`, http.StatusInternalServerError)
+		log.Printf("undoneTaskHandler: выполнение задачи id=%s не отменено: %v\n", id, err)
+		writeError(w, r, err, CodeStorage+".update")
 		return
 	}
-	log.Printf("doneTaskHandler: задача id=%s успешно обновлена\n", id)
+	log.Printf("undoneTaskHandler: выполнение задачи id=%s отменено\n", id)
 
+	w.Header().Set("ETag", taskETag(after.Version))
 	w.Write([]byte(`{}`))
 }
 
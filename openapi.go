@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPIJSON - описание API в формате OpenAPI 3, отдаётся по /api/openapi.json
+//
+//go:embed openapi.json
+var openAPIJSON []byte
+
+// openAPI - разобранное описание, по нему проверяются запросы
+var openAPI *openAPIDoc
+
+// validateRequests - проверять ли запросы по описанию (TODO_VALIDATE_REQUESTS=1).
+// Читается при запуске до настройки маршрутов.
+var validateRequests bool
+
+// pathParamRe - параметр в шаблоне адреса: {id}
+var pathParamRe = regexp.MustCompile(`\{[^}]+\}`)
+
+// openAPIDoc - часть OpenAPI, нужная для проверки запросов
+type openAPIDoc struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*apiSchema    `json:"schemas"`
+		Parameters map[string]*apiParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// apiOperation - метод по одному адресу
+type apiOperation struct {
+	Parameters  []*apiParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *apiSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// apiParameter - параметр запроса или заголовок
+type apiParameter struct {
+	Ref      string     `json:"$ref"`
+	Name     string     `json:"name"`
+	In       string     `json:"in"` // query, header или path
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+// apiSchema - поддерживаемое подмножество JSON Schema из OpenAPI 3.0
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Nullable             bool                  `json:"nullable"`
+	Enum                 []any                 `json:"enum"`
+	Pattern              string                `json:"pattern"`
+	MinLength            *int                  `json:"minLength"`
+	MaxLength            *int                  `json:"maxLength"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties *bool                 `json:"-"` // false - других полей быть не должно
+	Items                *apiSchema            `json:"items"`
+	MinItems             *int                  `json:"minItems"`
+	MaxItems             *int                  `json:"maxItems"`
+	OneOf                []*apiSchema          `json:"oneOf"`
+	AllOf                []*apiSchema          `json:"allOf"`
+
+	pattern *regexp.Regexp
+}
+
+// UnmarshalJSON - additionalProperties бывает и схемой, и true/false; проверяем только false
+func (s *apiSchema) UnmarshalJSON(data []byte) error {
+	type plain apiSchema
+	var raw struct {
+		plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = apiSchema(raw.plain)
+	if string(raw.AdditionalProperties) == "false" {
+		allowed := false
+		s.AdditionalProperties = &allowed
+	}
+	if s.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("неправильный pattern %q: %w", s.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// loadOpenAPI - разбирает встроенное описание API
+func loadOpenAPI() error {
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPIJSON, &doc); err != nil {
+		return fmt.Errorf("ошибка в openapi.json: %w", err)
+	}
+	openAPI = &doc
+	return nil
+}
+
+// checkOpenAPIRoutes - у каждого адреса из описания должен быть обработчик.
+// Так описание не отстаёт от маршрутов в main: лишний адрес не даст запустить сервер.
+func checkOpenAPIRoutes(mux *http.ServeMux) error {
+	for path, item := range openAPI.Paths {
+		// {id} в шаблоне заменяем любым значением
+		sample := pathParamRe.ReplaceAllString(path, "x")
+		for method := range item {
+			req, err := http.NewRequest(strings.ToUpper(method), sample, nil)
+			if err != nil {
+				return err
+			}
+			if _, pattern := mux.Handler(req); pattern == "" || pattern == "/api/" || pattern == "/" {
+				return fmt.Errorf("в openapi.json есть %s %s, но нет обработчика", strings.ToUpper(method), path)
+			}
+		}
+	}
+	return nil
+}
+
+// openAPIHandler - отдаёт описание API
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(openAPIJSON)
+}
+
+// withValidation - проверяет параметры и тело запроса по описанию API,
+// прежде чем передать запрос обработчику. Без validateRequests обработчик
+// возвращается как есть. Адреса и методы, которых нет в описании, проходят без проверки.
+// authMiddleware вызывает её уже после проверки токена, поэтому без токена
+// клиент получает 401, а не ошибки в запросе.
+func withValidation(next http.HandlerFunc) http.HandlerFunc {
+	if !validateRequests {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		op, pathParams := openAPI.operation(r)
+		if op != nil {
+			if err := openAPI.validateRequest(r, op, pathParams); err != nil {
+				writeError(w, r, err, CodeInternal)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// operation - описание метода для запроса и значения параметров из пути
+func (doc *openAPIDoc) operation(r *http.Request) (*apiOperation, map[string]string) {
+	for path, item := range doc.Paths {
+		params, ok := matchAPIPath(path, r.URL.Path)
+		if !ok {
+			continue
+		}
+		return item[strings.ToLower(r.Method)], params
+	}
+	return nil, nil
+}
+
+// matchAPIPath - подходит ли путь запроса к шаблону вида /api/v2/tasks/{id}
+func matchAPIPath(pattern, path string) (map[string]string, bool) {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i := range want {
+		if name, ok := strings.CutPrefix(want[i], "{"); ok {
+			params[strings.TrimSuffix(name, "}")] = got[i]
+		} else if want[i] != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// validateRequest - проверяет параметры и тело запроса.
+// Тело читается целиком и подкладывается обратно для обработчика.
+func (doc *openAPIDoc) validateRequest(r *http.Request, op *apiOperation, pathParams map[string]string) error {
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+		}
+		if p == nil {
+			continue
+		}
+		var value string
+		switch p.In {
+		case "query":
+			value = r.URL.Query().Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+		case "path":
+			value = pathParams[p.Name]
+		}
+		if value == "" {
+			if p.Required {
+				return newFieldError(CodeFieldRequired, p.Name)
+			}
+			continue
+		}
+		if err := doc.validateParam(p, value); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.RequestBody.Required {
+			return newAPIError(http.StatusBadRequest, CodeInvalidJSON)
+		}
+		return nil
+	}
+
+	// Схема берётся по Content-Type запроса, без него - для application/json
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		content = op.RequestBody.Content["application/json"]
+	}
+	if content.Schema == nil {
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return newAPIError(http.StatusBadRequest, CodeInvalidJSON)
+	}
+	return doc.validateValue(content.Schema, body, "", CodeInvalidField)
+}
+
+// validateParam - приводит значение параметра к типу из схемы и проверяет его
+func (doc *openAPIDoc) validateParam(p *apiParameter, value string) error {
+	schema := doc.resolve(p.Schema)
+	if schema == nil {
+		return nil
+	}
+	var v any = value
+	switch schema.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return newFieldError(CodeInvalidParam, p.Name)
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return newFieldError(CodeInvalidParam, p.Name)
+		}
+		v = b
+	}
+	return doc.validateValue(schema, v, p.Name, CodeInvalidParam)
+}
+
+// resolve - схема по ссылке $ref на components/schemas
+func (doc *openAPIDoc) resolve(s *apiSchema) *apiSchema {
+	for s != nil && s.Ref != "" {
+		s = doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// validateValue - проверяет значение v по схеме. field - путь к значению
+// (task.title, operations[0].op), code - код ошибки для неподходящего значения.
+func (doc *openAPIDoc) validateValue(s *apiSchema, v any, field, code string) error {
+	s = doc.resolve(s)
+	if s == nil {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable || (s.Type == "" && len(s.OneOf) == 0 && len(s.AllOf) == 0) {
+			return nil
+		}
+		return newFieldError(code, field)
+	}
+
+	for _, part := range s.AllOf {
+		if err := doc.validateValue(part, v, field, code); err != nil {
+			return err
+		}
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, part := range s.OneOf {
+			if doc.validateValue(part, v, field, code) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return newFieldError(code, field)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return newFieldError(code, field)
+		}
+	}
+
+	switch s.Type {
+	case "":
+		// Тип не указан: подходит любое значение
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return newFieldError(code, field)
+		}
+		length := len([]rune(str))
+		if (s.MinLength != nil && length < *s.MinLength) || (s.MaxLength != nil && length > *s.MaxLength) {
+			return newFieldError(code, field)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return newFieldError(code, field)
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok || (s.Type == "integer" && n != math.Trunc(n)) {
+			return newFieldError(code, field)
+		}
+		if (s.Minimum != nil && n < *s.Minimum) || (s.Maximum != nil && n > *s.Maximum) {
+			return newFieldError(code, field)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return newFieldError(code, field)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return newFieldError(code, field)
+		}
+		if (s.MinItems != nil && len(items) < *s.MinItems) || (s.MaxItems != nil && len(items) > *s.MaxItems) {
+			return newFieldError(code, field)
+		}
+		for i, item := range items {
+			if err := doc.validateValue(s.Items, item, fmt.Sprintf("%s[%d]", field, i), code); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return newFieldError(code, field)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return newFieldError(CodeFieldRequired, joinField(field, name))
+			}
+		}
+		// Поля проверяем по порядку, чтобы ошибка была одной и той же
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return newFieldError(CodeUnknownField, joinField(field, name))
+				}
+				continue
+			}
+			if err := doc.validateValue(prop, obj[name], joinField(field, name), code); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// joinField - путь к вложенному полю: task.title
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
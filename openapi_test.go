@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiErrorOf - код и поле ошибки из ответа
+func apiErrorOf(t *testing.T, body map[string]any) (string, string) {
+	t.Helper()
+	e, ok := body["error"].(map[string]any)
+	require.True(t, ok, "нет ошибки в ответе: %v", body)
+	field, _ := e["field"].(string)
+	return e["code"].(string), field
+}
+
+// validationMux - маршруты, как в main, с проверкой запросов или без неё
+func validationMux(t *testing.T, validate bool) *http.ServeMux {
+	t.Helper()
+	prev := validateRequests
+	validateRequests = validate
+	defer func() { validateRequests = prev }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/signin", withValidation(signinHandler))
+	mux.HandleFunc("/api/task", authMiddleware(taskHandler))
+	mux.HandleFunc("/api/tasks", authMiddleware(tasksHandler))
+	return mux
+}
+
+func TestValidation(t *testing.T) {
+	openTestDB(t)
+	require.NoError(t, loadOpenAPI())
+	t.Setenv("TODO_PASSWORD", "secret")
+	mux := validationMux(t, true)
+
+	// Без токена - 401, даже если запрос не подходит под описание
+	rec := serve(t, mux, http.MethodPost, "/api/task", map[string]any{"title": 5})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	code, _ := apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeAuthRequired, code)
+	rec = serve(t, mux, http.MethodGet, "/api/tasks?overdue=yes", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Вход тоже проверяется по описанию
+	rec = serve(t, mux, http.MethodPost, "/api/signin", map[string]any{"password": 1})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	code, field := apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeInvalidField, code)
+	assert.Equal(t, "password", field)
+
+	rec = serve(t, mux, http.MethodPost, "/api/signin", map[string]string{"password": "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	token := decodeJSON(t, rec)["token"].(string)
+	cookie := "token=" + token
+
+	// Тело с полем не того типа
+	rec = serve(t, mux, http.MethodPost, "/api/task", map[string]any{"title": 5}, "Cookie", cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	code, field = apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeInvalidField, code)
+	assert.Equal(t, "title", field)
+
+	// Параметр не из списка: сам обработчик принял бы его как "0"
+	rec = serve(t, mux, http.MethodGet, "/api/tasks?overdue=yes", nil, "Cookie", cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	code, field = apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeInvalidParam, code)
+	assert.Equal(t, "overdue", field)
+
+	// Правильный запрос доходит до обработчика
+	rec = serve(t, mux, http.MethodPost, "/api/task", map[string]string{"date": "20990101", "title": "Прошла проверку"}, "Cookie", cookie)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotEmpty(t, decodeJSON(t, rec)["id"])
+	rec = serve(t, mux, http.MethodGet, "/api/tasks?overdue=0", nil, "Cookie", cookie)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Len(t, decodeJSON(t, rec)["tasks"], 1)
+
+	// Без TODO_VALIDATE_REQUESTS запрос проверяет только обработчик
+	rec = serve(t, validationMux(t, false), http.MethodGet, "/api/tasks?overdue=yes", nil, "Cookie", cookie)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
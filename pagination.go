@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+const (
+	defaultPageSize = 50  // Сколько задач в странице по умолчанию
+	maxPageSize     = 500 // Больше за один запрос не отдаём
+)
+
+// pageCursor - место, с которого начинается следующая страница.
+// Для списков по дате это последняя показанная задача (значение сортировки и ключ),
+// для выдачи по релевантности - сколько задач уже показано.
+// Клиенту курсор отдаётся непрозрачной строкой.
+type pageCursor struct {
+	Value  string `json:"v,omitempty"` // Значение колонки сортировки у последней задачи
+	Key    int64  `json:"k,omitempty"` // Ключ последней задачи, различает задачи с одинаковым значением
+	Offset int    `json:"o,omitempty"` // Сколько задач пропустить
+	Sort   string `json:"s,omitempty"` // Порядок, для которого выдан курсор
+}
+
+// encode - курсор в виде строки для next_cursor
+func (c pageCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor - разбирает курсор, полученный от клиента
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
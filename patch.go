@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// patchTask - частично изменяет задачу по правилам JSON Merge Patch (RFC 7396).
+// PATCH /api/task?id=<id>: в теле только изменяемые поля, остальные остаются прежними.
+// null удаляет значение: "comment": null - пустой комментарий, "repeat": null - без повторения,
+// "date": null - задача уходит в бэклог.
+func patchTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON).text(CodeInvalidJSON+".patch"))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if raw, ok := patch["id"]; ok {
+		var bodyID string
+		if err := json.Unmarshal(raw, &bodyID); err != nil || (id != "" && bodyID != id) {
+			writeAPIError(w, r, newFieldError(CodeIDMismatch, "id"))
+			return
+		}
+		id = bodyID
+		delete(patch, "id")
+	}
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = mergeTask(tx, r, id, patch, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(after.Version))
+	json.NewEncoder(w).Encode(after)
+}
+
+// mergeTask - применяет патч к задаче внутри транзакции и возвращает её новое состояние.
+// match - ожидаемая версия в формате If-Match, пустая строка - любая.
+func mergeTask(tx *sql.Tx, r *http.Request, id string, patch map[string]json.RawMessage, match string) (*Task, error) {
+	before, err := loadTask(r.Context(), tx, id)
+	if err == sql.ErrNoRows {
+		return nil, newAPIError(http.StatusNotFound, CodeTaskNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	if !matchETag(match, before.Version) {
+		return nil, newAPIError(http.StatusPreconditionFailed, CodeVersionMismatch)
+	}
+
+	task := *before
+	if err := applyTaskPatch(&task, patch, time.Now()); err != nil {
+		return nil, err
+	}
+	stored := task
+	if err := encryptTask(&stored); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, CodeEncryption)
+	}
+
+	_, err = tx.ExecContext(r.Context(), `UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ?, version = version + 1
+		WHERE id = ?`,
+		stored.Date, stored.Title, stored.Comment, stored.Repeat, before.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := loadTask(r.Context(), tx, before.Key)
+	if err != nil {
+		return nil, err
+	}
+	return after, writeAudit(tx, r, AuditUpdate, before.Key, before, after)
+}
+
+// applyTaskPatch - переносит в задачу поля из патча и проверяет только их.
+// Правило повторения проверяется заново, если изменилось оно или дата:
+// новое правило должно подходить к прежней дате, а прежнее - к новой.
+func applyTaskPatch(task *Task, patch map[string]json.RawMessage, now time.Time) error {
+	var backlog bool
+	for field, raw := range patch {
+		var err error
+		switch field {
+		case "title":
+			// null в Unmarshal оставляет строку прежней, поэтому очищаем её заранее
+			task.Title = ""
+			err = json.Unmarshal(raw, &task.Title)
+			if err == nil && task.Title == "" {
+				return newFieldError(CodeTitleRequired, "title")
+			}
+		case "comment":
+			task.Comment = ""
+			err = json.Unmarshal(raw, &task.Comment)
+		case "date":
+			var date *string
+			if err = json.Unmarshal(raw, &date); err == nil {
+				if date == nil {
+					task.Date = ""
+				} else if task.Date, err = normalizeDate(*date, now); err != nil {
+					return err
+				}
+			}
+		case "repeat":
+			if task.Repeat, err = decodeRepeat(raw); err != nil {
+				return repeatError(err)
+			}
+		case "backlog":
+			err = json.Unmarshal(raw, &backlog)
+		case "status", "completed_at", "version":
+			return newFieldError(CodeReadOnlyField, field)
+		default:
+			return newFieldError(CodeUnknownField, field)
+		}
+		if err != nil {
+			return newFieldError(CodeInvalidField, field)
+		}
+	}
+
+	if backlog {
+		if _, ok := patch["date"]; ok && task.Date != "" {
+			return newFieldError(CodeInvalidDate, "date").text(CodeInvalidDate + ".backlog")
+		}
+		task.Date = ""
+	}
+	_, dateChanged := patch["date"]
+	_, repeatChanged := patch["repeat"]
+	if dateChanged || repeatChanged || backlog {
+		return checkRepeat(*task, now)
+	}
+	return nil
+}
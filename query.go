@@ -0,0 +1,249 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryTerm - одно условие из запроса q, например due<7d, repeat:none, -comment:черновик или "отчёт"
+type queryTerm struct {
+	Field  string // title, comment, due, repeat; пустое - текст в заголовке или комментарии
+	Op     string // Для due: <, <=, >, >=, =
+	Value  string
+	Negate bool // Условие с минусом: задача ему НЕ должна соответствовать
+}
+
+// taskQuery - разобранный запрос для /api/tasks?q= и сохранённых списков.
+// Все условия объединяются через И.
+type taskQuery struct {
+	Status string // status:open|completed|all, пустое - как в параметре status
+	Terms  []queryTerm
+}
+
+// queryFields - поля, которые понимает запрос. Слово с другим префиксом
+// (например "10:30") считается обычным текстом.
+var queryFields = map[string]bool{"title": true, "comment": true, "due": true, "repeat": true, "status": true}
+
+// parseTaskQuery - разбирает запрос вида `due<7d repeat:none "отчёт" -comment:черновик`.
+// Даты в due: today, overdue, 20060102 или сдвиг от сегодня: 3d, 2w.
+func parseTaskQuery(s string) (taskQuery, error) {
+	var q taskQuery
+	tokens, err := splitQuery(s)
+	if err != nil {
+		return q, err
+	}
+
+	for _, token := range tokens {
+		term := queryTerm{Negate: token.negate}
+		if strings.HasPrefix(token.text, "-") && !token.quoted {
+			term.Negate = true
+			token.text = token.text[1:]
+		}
+
+		field, op, value := "", "", token.text
+		if !token.quoted {
+			if i := strings.IndexAny(token.text, ":<>="); i > 0 && queryFields[token.text[:i]] {
+				field = token.text[:i]
+				op, value = splitOp(token.text[i:])
+				// Значение в кавычках сразу после поля: title:"годовой отчёт"
+				if value == "" && token.next != nil {
+					value = *token.next
+				}
+			}
+		}
+		if value == "" {
+			return q, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".empty", token.text)
+		}
+
+		switch field {
+		case "":
+			term.Value = value
+		case "title", "comment":
+			if op != ":" {
+				return q, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".form", field)
+			}
+			term.Field, term.Value = field, value
+		case "due":
+			term.Field = field
+			switch {
+			case op == ":" && value == "today":
+				term.Op, term.Value = "=", value
+			case op == ":" && value == "overdue":
+				term.Op, term.Value = "<", "today"
+			case op == ":":
+				term.Op, term.Value = "=", value
+			default:
+				term.Op, term.Value = op, value
+			}
+			if _, err := relativeDate(term.Value, time.Now()); err != nil {
+				return q, err
+			}
+		case "repeat":
+			switch value {
+			case "none", "any", RepeatDaily, RepeatYearly:
+			default:
+				return q, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".enum", "repeat", "none, any, d, y")
+			}
+			term.Field, term.Value = field, value
+		case "status":
+			if term.Negate {
+				return q, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".negate", "status")
+			}
+			switch value {
+			case StatusOpen, StatusCompleted, "all":
+			default:
+				return q, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".enum", "status", "open, completed, all")
+			}
+			q.Status = value
+			continue
+		}
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+// queryToken - слово запроса; next - фраза в кавычках, идущая сразу за словом без пробела
+type queryToken struct {
+	text   string
+	quoted bool
+	negate bool // Минус перед фразой в кавычках: -"черновик"
+	next   *string
+}
+
+// splitQuery - делит запрос на слова, фразы в кавычках остаются целыми
+func splitQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery + ".quote")
+			}
+			tokens = append(tokens, queryToken{text: s[1 : end+1], quoted: true})
+			s = s[end+2:]
+			continue
+		}
+
+		end := strings.IndexAny(s, " \t\"")
+		if end < 0 {
+			end = len(s)
+		}
+		token := queryToken{text: s[:end]}
+		s = s[end:]
+		// title:"годовой отчёт" и -"черновик": фраза относится к слову перед ней
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil, newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery + ".quote")
+			}
+			phrase := s[1 : end+1]
+			s = s[end+2:]
+			if token.text == "-" {
+				token = queryToken{text: phrase, quoted: true, negate: true}
+			} else {
+				token.next = &phrase
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// splitOp - отделяет оператор (":", "<", "<=", ">", ">=", "=") от значения
+func splitOp(s string) (string, string) {
+	for _, op := range []string{"<=", ">=", ":", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):]
+		}
+	}
+	return "", s
+}
+
+// relativeDate - дата из запроса в формате 20060102: today, 20060102 или сдвиг от сегодня (3d, 2w)
+func relativeDate(value string, now time.Time) (string, error) {
+	if value == "today" {
+		return now.Format("20060102"), nil
+	}
+	if len(value) == 8 {
+		if _, err := time.Parse("20060102", value); err == nil {
+			return value, nil
+		}
+	}
+	if n := len(value); n > 1 {
+		if days, err := strconv.Atoi(value[:n-1]); err == nil && days >= -3650 && days <= 3650 {
+			switch value[n-1] {
+			case 'd':
+				return now.AddDate(0, 0, days).Format("20060102"), nil
+			case 'w':
+				return now.AddDate(0, 0, 7*days).Format("20060102"), nil
+			}
+		}
+	}
+	return "", newFieldError(CodeInvalidQuery, "q").text(CodeInvalidQuery+".date", value)
+}
+
+// hasText - есть ли в запросе текстовые условия. Их проверяет matchText в Go:
+// LIKE в SQLite не различает регистр только у латиницы, а при шифровании видит лишь шифротекст.
+func (q taskQuery) hasText() bool {
+	for _, term := range q.Terms {
+		if term.Field == "" || term.Field == "title" || term.Field == "comment" {
+			return true
+		}
+	}
+	return false
+}
+
+// where - условия SQL и их аргументы для дат и правил повторения
+func (q taskQuery) where(now time.Time) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	for _, term := range q.Terms {
+		var cond string
+		switch term.Field {
+		case "due":
+			date, _ := relativeDate(term.Value, now)
+			cond = "date " + term.Op + " ?"
+			args = append(args, date)
+		case "repeat":
+			switch term.Value {
+			case "none":
+				cond = "COALESCE(repeat, '') = ''"
+			case "any":
+				cond = "repeat != ''"
+			default:
+				cond = "(repeat = ? OR repeat LIKE ?)"
+				args = append(args, term.Value, term.Value+" %")
+			}
+		default:
+			continue
+		}
+		if term.Negate {
+			cond = "NOT (" + cond + ")"
+		}
+		where = append(where, cond)
+	}
+	return where, args
+}
+
+// matchText - проверяет текстовые условия без учёта регистра
+func (q taskQuery) matchText(task Task) bool {
+	for _, term := range q.Terms {
+		var text string
+		switch term.Field {
+		case "":
+			text = task.Title + " " + task.Comment
+		case "title":
+			text = task.Title
+		case "comment":
+			text = task.Comment
+		default:
+			continue
+		}
+		found := strings.Contains(strings.ToLower(text), strings.ToLower(term.Value))
+		if found == term.Negate {
+			return false
+		}
+	}
+	return true
+}
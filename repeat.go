@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RepeatRule - разобранное правило повторения, чтобы клиентам не разбирать строку самим.
+// Строка "d 7" - {"kind":"d","interval":7}, "y" - {"kind":"y"}.
+// Правила "w" и "m" из формата планировщик не поддерживает и не принимает.
+type RepeatRule struct {
+	Kind     string `json:"kind"`
+	Interval int    `json:"interval,omitempty"` // Для d: через сколько дней
+}
+
+var (
+	errUnsupportedRepeat = errors.New("неподдерживаемое правило")
+	errRepeatDays        = errors.New("для 'd' нужно указать число дней от 1 до 400")
+)
+
+// parseRepeat - разбирает строку правила повторения. Это единственный разбор правила:
+// им проверяются задачи при записи и по нему же считаются следующие даты.
+func parseRepeat(repeat string) (*RepeatRule, error) {
+	parts := strings.Fields(repeat)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("правило повторения не указано")
+	}
+
+	rule := &RepeatRule{Kind: parts[0]}
+	switch rule.Kind {
+	case RepeatYearly:
+		if len(parts) != 1 {
+			return nil, fmt.Errorf("у правила 'y' нет параметров")
+		}
+	case RepeatDaily:
+		if len(parts) != 2 {
+			return nil, errRepeatDays
+		}
+		var err error
+		if rule.Interval, err = strconv.Atoi(parts[1]); err != nil {
+			return nil, errRepeatDays
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedRepeat, rule.Kind)
+	}
+
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// validate - проверяет, что параметры правила в допустимых пределах
+func (rule *RepeatRule) validate() error {
+	switch rule.Kind {
+	case RepeatYearly:
+		if rule.Interval != 0 {
+			return fmt.Errorf("у правила 'y' нет параметров")
+		}
+	case RepeatDaily:
+		if rule.Interval <= 0 || rule.Interval > 400 {
+			return errRepeatDays
+		}
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedRepeat, rule.Kind)
+	}
+	return nil
+}
+
+// next - дата через один шаг правила
+func (rule *RepeatRule) next(date time.Time) time.Time {
+	if rule.Kind == RepeatDaily {
+		return date.AddDate(0, 0, rule.Interval)
+	}
+	next := date.AddDate(1, 0, 0)
+	// Корректируем високосный 29 февраля
+	if next.Day() == 29 && next.Month() == time.February && !isLeapYear(next.Year()) {
+		next = time.Date(next.Year(), time.March, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return next
+}
+
+// repeatError - ошибка API для правила, которое не разобрал parseRepeat
+func repeatError(err error) error {
+	apiErr := newFieldError(CodeInvalidRepeat, "repeat")
+	switch {
+	case errors.Is(err, errUnsupportedRepeat):
+		return apiErr.text(CodeInvalidRepeat + ".kind")
+	case errors.Is(err, errRepeatDays):
+		return apiErr.text(CodeInvalidRepeat + ".days")
+	}
+	return apiErr
+}
+
+// String - правило в виде строки, как оно хранится в базе
+func (rule *RepeatRule) String() string {
+	if rule.Kind == RepeatDaily {
+		return RepeatDaily + " " + strconv.Itoa(rule.Interval)
+	}
+	return rule.Kind
+}
+
+// decodeRepeat - правило из тела запроса: строка "d 7" или объект RepeatRule.
+// Правило проверяется и хранится в базе строкой в одном виде ("d  7" станет "d 7").
+func decodeRepeat(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var repeat string
+	if err := json.Unmarshal(raw, &repeat); err == nil {
+		if repeat == "" {
+			return "", nil
+		}
+		rule, err := parseRepeat(repeat)
+		if err != nil {
+			return "", err
+		}
+		return rule.String(), nil
+	}
+
+	var rule RepeatRule
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		return "", fmt.Errorf("правило повторения должно быть строкой или объектом: %w", err)
+	}
+	if err := rule.validate(); err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultArchiveAfterDays  = 180            // Через сколько дней выполненные задачи уходят в архив
+	defaultPurgeAfterDays    = 30             // Сколько дней хранятся следы удалённых задач
+	defaultRetentionInterval = 24 * time.Hour // Как часто запускать очистку
+)
+
+// retentionPolicy - правила хранения старых данных. Ноль отключает правило.
+type retentionPolicy struct {
+	archiveAfterDays int
+	purgeAfterDays   int
+}
+
+// ArchivedTask - задача, перенесённая в архив
+type ArchivedTask struct {
+	Task
+	ArchivedAt string `json:"archived_at"`
+}
+
+// runRetention - применяет правила хранения сразу и затем с периодом interval, пока не отменён ctx
+func runRetention(ctx context.Context, policy retentionPolicy, interval time.Duration) {
+	log.Printf("runRetention: архив через %d дн., очистка удалённых через %d дн., период %v\n",
+		policy.archiveAfterDays, policy.purgeAfterDays, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if maintenance.Load() {
+			log.Println("runRetention: режим обслуживания, очистка пропущена")
+		} else if err := applyRetention(ctx, policy, time.Now()); err != nil {
+			log.Printf("runRetention: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyRetention - переносит старые выполненные задачи в архив и удаляет следы давно удалённых задач
+func applyRetention(ctx context.Context, policy retentionPolicy, now time.Time) error {
+	var archived, purged int64
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		archived, purged = 0, 0
+		if policy.archiveAfterDays > 0 {
+			cutoff := dbTime(now.AddDate(0, 0, -policy.archiveAfterDays))
+			_, err := tx.ExecContext(ctx, `INSERT INTO archive (id, uid, date, title, comment, repeat, status, completed_at, version, archived_at)
+				SELECT id, uid, date, title, comment, repeat, status, completed_at, version, ?
+				FROM scheduler WHERE status = ? AND completed_at < ?`,
+				dbTime(now), StatusCompleted, cutoff)
+			if err != nil {
+				return err
+			}
+			result, err := tx.ExecContext(ctx, "DELETE FROM scheduler WHERE status = ? AND completed_at < ?", StatusCompleted, cutoff)
+			if err != nil {
+				return err
+			}
+			archived, _ = result.RowsAffected()
+		}
+
+		if policy.purgeAfterDays > 0 {
+			// Удалённая задача остаётся в журнале изменений, и её можно вернуть через откат.
+			// Когда последняя запись о ней старше срока, журнал и история выполнений очищаются.
+			cutoff := dbTime(now.AddDate(0, 0, -policy.purgeAfterDays))
+			const deleted = `task_id NOT IN (SELECT id FROM scheduler) AND task_id NOT IN (SELECT id FROM archive)`
+			result, err := tx.ExecContext(ctx, `DELETE FROM audit_log WHERE `+deleted+` AND task_id IN (
+					SELECT task_id FROM audit_log GROUP BY task_id HAVING MAX(created_at) < ?)`, cutoff)
+			if err != nil {
+				return err
+			}
+			purged, _ = result.RowsAffected()
+			_, err = tx.ExecContext(ctx, `DELETE FROM completions WHERE `+deleted+` AND task_id NOT IN (SELECT task_id FROM audit_log)
+				AND completed_at < ?`, cutoff)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if archived > 0 || purged > 0 {
+		log.Printf("applyRetention: в архив перенесено задач: %d, удалено записей журнала: %d\n", archived, purged)
+	}
+	return nil
+}
+
+// archiveHandler - возвращает архивные задачи, сначала недавно выполненные.
+// Параметры limit (по умолчанию 50) и offset.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+		return
+	}
+
+	limit, offset := 50, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "limit"))
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, r, newFieldError(CodeInvalidParam, "offset"))
+			return
+		}
+		offset = n
+	}
+
+	rows, err := db.QueryContext(r.Context(), `SELECT `+taskColumns+`, archived_at FROM archive
+		ORDER BY completed_at DESC, id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		log.Printf("archiveHandler: ошибка запроса: %v\n", err)
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	defer rows.Close()
+
+	tasks := []ArchivedTask{}
+	for rows.Next() {
+		var t ArchivedTask
+		err := rows.Scan(&t.Key, &t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat, &t.Status, &t.CompletedAt, &t.Version, &t.ArchivedAt)
+		if err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		if err := prepareTask(&t.Task); err != nil {
+			writeAPIError(w, r, newAPIError(http.StatusInternalServerError, CodeEncryption).text(CodeEncryption+".decrypt"))
+			return
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRetention(t *testing.T) {
+	openTestDB(t)
+	// Сервер в поясе +03:00: сроки всё равно считаются по UTC
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	policy := retentionPolicy{archiveAfterDays: 180, purgeAfterDays: 30}
+	cutoff := now.AddDate(0, 0, -180)
+
+	insert := func(id int, status string, completedAt time.Time) {
+		_, err := db.Exec(`INSERT INTO scheduler (id, uid, date, title, status, completed_at) VALUES (?, ?, '20250101', ?, ?, ?)`,
+			id, newULID(completedAt), "Задача", status, dbTime(completedAt))
+		require.NoError(t, err)
+	}
+	insert(1, StatusCompleted, cutoff.Add(-time.Hour)) // Старше срока - в архив
+	insert(2, StatusCompleted, cutoff.Add(time.Hour))  // Моложе срока на час - остаётся
+	insert(3, StatusOpen, cutoff.Add(-time.Hour))      // Открытые задачи не архивируются
+	_, err := db.Exec("UPDATE scheduler SET completed_at = NULL WHERE id = 3")
+	require.NoError(t, err)
+
+	// Следы удалённых задач: 10 удалена давно, 11 - недавно
+	for _, v := range []struct {
+		id  int
+		age time.Duration
+	}{{10, 40 * 24 * time.Hour}, {11, 24 * time.Hour}} {
+		_, err := db.Exec(`INSERT INTO audit_log (created_at, actor, ip, action, task_id) VALUES (?, 'test', '', 'delete', ?)`,
+			dbTime(now.Add(-v.age)), v.id)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO completions (task_id, scheduled_date, completed_at) VALUES (?, '20250101', ?)`,
+			v.id, dbTime(now.Add(-v.age)))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, applyRetention(context.Background(), policy, now))
+
+	ids := func(query string) []int {
+		rows, err := db.Query(query)
+		require.NoError(t, err)
+		defer rows.Close()
+		var ret []int
+		for rows.Next() {
+			var id int
+			require.NoError(t, rows.Scan(&id))
+			ret = append(ret, id)
+		}
+		return ret
+	}
+	assert.Equal(t, []int{2, 3}, ids("SELECT id FROM scheduler ORDER BY id"))
+	assert.Equal(t, []int{1}, ids("SELECT id FROM archive"))
+	assert.Equal(t, []int{11}, ids("SELECT task_id FROM audit_log"))
+	assert.Equal(t, []int{11}, ids("SELECT task_id FROM completions"))
+
+	var archivedAt string
+	require.NoError(t, db.QueryRow("SELECT archived_at FROM archive WHERE id = 1").Scan(&archivedAt))
+	assert.Equal(t, "2025-07-01T09:00:00Z", archivedAt)
+
+	// Повторный запуск ничего не меняет
+	require.NoError(t, applyRetention(context.Background(), policy, now))
+	assert.Equal(t, []int{1}, ids("SELECT id FROM archive"))
+}
+
+func TestTimestampsMigratedToUTC(t *testing.T) {
+	openTestDB(t)
+	_, err := db.Exec(`INSERT INTO scheduler (date, title, status, completed_at) VALUES ('20250101', 'Старая', 'completed', '2025-01-01T02:30:00+03:00')`)
+	require.NoError(t, err)
+	require.NoError(t, migrateDB())
+
+	var completedAt string
+	require.NoError(t, db.QueryRow("SELECT completed_at FROM scheduler").Scan(&completedAt))
+	assert.Equal(t, "2024-12-31T23:30:00Z", completedAt)
+}
+
+func TestArchiveHandler(t *testing.T) {
+	openTestDB(t)
+	useTestKey(t, "ключ архива")
+	comment, err := encryptField("секретный комментарий")
+	require.NoError(t, err)
+	for i, completedAt := range []string{"2024-01-01T10:00:00Z", "2024-03-01T10:00:00Z", "2024-02-01T10:00:00Z"} {
+		_, err := db.Exec(`INSERT INTO archive (id, uid, date, title, comment, repeat, status, completed_at, version, archived_at)
+			VALUES (?, ?, '20240101', ?, ?, '', 'completed', ?, 1, '2025-01-01T00:00:00Z')`,
+			i+1, newULID(time.Now()), "Архивная "+completedAt[:7], comment, completedAt)
+		require.NoError(t, err)
+	}
+
+	get := func(query string) []map[string]any {
+		rec := serve(t, http.HandlerFunc(archiveHandler), http.MethodGet, "/api/archive"+query, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var tasks []map[string]any
+		for _, task := range decodeJSON(t, rec)["tasks"].([]any) {
+			tasks = append(tasks, task.(map[string]any))
+		}
+		return tasks
+	}
+
+	// Сначала недавно выполненные, комментарий расшифрован
+	tasks := get("")
+	require.Len(t, tasks, 3)
+	assert.Equal(t, "Архивная 2024-03", tasks[0]["title"])
+	assert.Equal(t, "Архивная 2024-02", tasks[1]["title"])
+	assert.Equal(t, "Архивная 2024-01", tasks[2]["title"])
+	assert.Equal(t, "секретный комментарий", tasks[0]["comment"])
+	assert.Equal(t, "2025-01-01T00:00:00Z", tasks[0]["archived_at"])
+
+	tasks = get("?limit=1&offset=1")
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Архивная 2024-02", tasks[0]["title"])
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?offset=-1"} {
+		rec := serve(t, http.HandlerFunc(archiveHandler), http.MethodGet, "/api/archive"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+	rec := serve(t, http.HandlerFunc(archiveHandler), http.MethodPost, "/api/archive", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ftsEnabled - доступен ли полнотекстовый индекс FTS5.
+// Драйвер sqlite3 поддерживает FTS5 только при сборке с тегом sqlite_fts5,
+// без него поиск проверяет задачи в Go (matchesSearch).
+var ftsEnabled bool
+
+// ftsIndex - полнотекстовый индекс по заголовку и комментарию задачи
+type ftsIndex struct {
+	table    string
+	tokenize string
+}
+
+// ftsIndexes - все индексы, которые держим в актуальном состоянии.
+// unicode61 приводит к одному регистру любые буквы, а не только ASCII,
+// remove_diacritics 2 убирает диакритику у латинских букв ("café" находится по "cafe").
+// trigram разбивает текст на тройки символов для нечёткого поиска.
+var ftsIndexes = []ftsIndex{
+	{table: "scheduler_fts", tokenize: "unicode61 remove_diacritics 2"},
+	{table: "scheduler_trigram", tokenize: "trigram"},
+}
+
+// triggers - триггеры, которые переносят изменения scheduler в индекс
+func (idx ftsIndex) triggers() map[string]string {
+	t := idx.table
+	return map[string]string{
+		t + "_ai": `CREATE TRIGGER ` + t + `_ai AFTER INSERT ON scheduler BEGIN
+            INSERT INTO ` + t + ` (rowid, title, comment) VALUES (new.id, new.title, new.comment);
+        END`,
+		t + "_ad": `CREATE TRIGGER ` + t + `_ad AFTER DELETE ON scheduler BEGIN
+            INSERT INTO ` + t + ` (` + t + `, rowid, title, comment) VALUES ('delete', old.id, old.title, old.comment);
+        END`,
+		t + "_au": `CREATE TRIGGER ` + t + `_au AFTER UPDATE OF title, comment ON scheduler BEGIN
+            INSERT INTO ` + t + ` (` + t + `, rowid, title, comment) VALUES ('delete', old.id, old.title, old.comment);
+            INSERT INTO ` + t + ` (rowid, title, comment) VALUES (new.id, new.title, new.comment);
+        END`,
+	}
+}
+
+// initFTS - создаёт полнотекстовые индексы по заголовку и комментарию.
+// Наличие FTS5 проверяется до всего остального: CREATE VIRTUAL TABLE IF NOT EXISTS
+// не падает, если таблица осталась от сборки с FTS5, а триггеры на неё сломали бы запись.
+func initFTS() error {
+	var available bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return fmt.Errorf("проверка FTS5: %w", err)
+	}
+	if !available {
+		return dropFTSTriggers()
+	}
+
+	for _, idx := range ftsIndexes {
+		_, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + idx.table + ` USING fts5(
+            title, comment,
+            content='scheduler', content_rowid='id',
+            tokenize='` + idx.tokenize + `'
+        )`)
+		if err != nil {
+			return fmt.Errorf("таблица %s: %w", idx.table, err)
+		}
+
+		// Если какого-то триггера нет, индекс мог отстать от таблицы - перестраиваем его
+		rebuild := false
+		for name, stmt := range idx.triggers() {
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", name).
+				Scan(&count); err != nil {
+				return fmt.Errorf("проверка триггера %s: %w", name, err)
+			}
+			if count > 0 {
+				continue
+			}
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("триггер %s: %w", name, err)
+			}
+			rebuild = true
+		}
+		if rebuild {
+			if _, err := db.Exec("INSERT INTO " + idx.table + " (" + idx.table + ") VALUES ('rebuild')"); err != nil {
+				return fmt.Errorf("перестроение %s: %w", idx.table, err)
+			}
+			log.Printf("initFTS: индекс %s перестроен\n", idx.table)
+		}
+	}
+
+	ftsEnabled = true
+	return nil
+}
+
+// dropFTSTriggers - убирает триггеры индексов, когда FTS5 недоступен.
+// Без FTS5 они ломали бы любую запись в scheduler. Индексы перестроятся,
+// когда сервер снова запустят с FTS5.
+func dropFTSTriggers() error {
+	log.Println("initFTS: FTS5 недоступен, поиск будет проверять задачи без индекса")
+	for _, idx := range ftsIndexes {
+		for name := range idx.triggers() {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("удаление триггера %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ftsQuery - превращает строку поиска в запрос FTS5.
+// Каждое слово ищется по префиксу, все слова должны встретиться в задаче.
+// Слова берутся в кавычки, чтобы операторы FTS5 в тексте не ломали запрос.
+func ftsQuery(search string) string {
+	var terms []string
+	for _, word := range strings.Fields(search) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// ftsJoin - подзапрос с найденными задачами, их рейтингом и подсвеченными фрагментами.
+// Присоединяется к scheduler по match_id.
+const ftsJoin = ` JOIN (
+        SELECT rowid AS match_id,
+            bm25(scheduler_fts) AS match_rank,
+            highlight(scheduler_fts, 0, '<mark>', '</mark>') AS title_snippet,
+            snippet(scheduler_fts, 1, '<mark>', '</mark>', '…', 12) AS comment_snippet
+        FROM scheduler_fts WHERE scheduler_fts MATCH ?
+    ) AS m ON m.match_id = scheduler.id`
+
+// matchesSearch - есть ли в задаче все слова запроса без учёта регистра.
+// Используется, когда поля зашифрованы или FTS5 недоступен и искать средствами SQLite нельзя.
+func matchesSearch(task Task, search string) bool {
+	text := strings.ToLower(task.Title + " " + task.Comment)
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 	"net/http/cookiejar"
-	"strconv"
 	"testing"
 	"time"
 
@@ -60,6 +59,39 @@ func requestJSON(apipath string, values map[string]any, method string) ([]byte,
 	return io.ReadAll(resp.Body)
 }
 
+// requestHeaders - запрос к API с заголовками из header; body кодируется в JSON.
+// Возвращает ответ с уже прочитанным и закрытым телом.
+func requestHeaders(method, apipath string, body any, header map[string]string) (*http.Response, []byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, nil, err
+		}
+	}
+	req, err := http.NewRequest(method, getURL(apipath), bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	if len(Token) > 0 {
+		req.AddCookie(&http.Cookie{Name: "token", Value: Token})
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	ret, err := io.ReadAll(resp.Body)
+	return resp, ret, err
+}
+
 func postJSON(apipath string, values map[string]any, method string) (map[string]any, error) {
 	var (
 		m   map[string]any
@@ -136,9 +168,9 @@ func TestAddTask(t *testing.T) {
 			}
 			id := fmt.Sprint(mid)
 
-			err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+			err = db.Get(&task, `SELECT id, uid, date, title, comment, repeat FROM scheduler WHERE uid=?`, id)
 			assert.NoError(t, err)
-			assert.Equal(t, id, strconv.FormatInt(task.ID, 10))
+			assert.Equal(t, id, task.UID)
 
 			assert.Equal(t, v.title, task.Title)
 			assert.Equal(t, v.comment, task.Comment)
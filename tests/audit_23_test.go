@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type auditEntry struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	TaskID string `json:"task_id"`
+	Diff   map[string]struct {
+		Before any `json:"before"`
+		After  any `json:"after"`
+	} `json:"diff"`
+}
+
+func getAudit(t *testing.T, query string) []auditEntry {
+	body, err := requestJSON("api/audit?"+query, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var ret struct {
+		Audit []auditEntry `json:"audit"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &ret), string(body))
+	return ret.Audit
+}
+
+func actions(entries []auditEntry) []string {
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.Action)
+	}
+	return ret
+}
+
+func TestAudit(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	id := addTask(t, task{date: "20950101", title: "Журнал до", comment: "без изменений"})
+	defer postJSON("api/task?id="+id, nil, http.MethodDelete)
+	_, err := postJSON("api/task", map[string]any{
+		"id": id, "date": "20950101", "title": "Журнал после", "comment": "без изменений",
+	}, http.MethodPut)
+	assert.NoError(t, err)
+
+	// Сначала новые записи, в diff только изменённые поля
+	entries := getAudit(t, "task_id="+id)
+	assert.Equal(t, []string{"update", "create"}, actions(entries))
+	if len(entries) == 2 {
+		update := entries[0]
+		assert.Equal(t, id, update.TaskID)
+		assert.Equal(t, "Журнал до", update.Diff["title"].Before)
+		assert.Equal(t, "Журнал после", update.Diff["title"].After)
+		assert.Contains(t, update.Diff, "version")
+		assert.NotContains(t, update.Diff, "date")
+		assert.NotContains(t, update.Diff, "comment")
+
+		create := entries[1]
+		assert.Nil(t, create.Diff["title"].Before)
+		assert.Equal(t, "Журнал до", create.Diff["title"].After)
+	}
+
+	// Фильтры
+	today := time.Now()
+	assert.Equal(t, []string{"create"}, actions(getAudit(t, "task_id="+id+"&action=create")))
+	assert.Equal(t, []string{"update"}, actions(getAudit(t, "task_id="+id+"&limit=1")))
+	assert.Len(t, getAudit(t, "task_id="+id+"&from="+today.Format("20060102")+"&to="+today.Format("20060102")), 2)
+	assert.Empty(t, getAudit(t, "task_id="+id+"&from="+today.AddDate(0, 0, 1).Format("20060102")))
+	assert.Empty(t, getAudit(t, "task_id="+id+"&to="+today.AddDate(0, 0, -1).Format("20060102")))
+	assert.Empty(t, getAudit(t, "task_id="+id+"&actor=никто"))
+	for _, query := range []string{"limit=0", "limit=1001", "from=2025-01-01", "to=завтра"} {
+		status, _, apiErr := errorResponse(t, http.MethodGet, "api/audit?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+		assert.Equal(t, "invalid_param", apiErr.Code, query)
+	}
+
+	// Откат проверяет If-Match, как PUT и DELETE
+	status, _ := requestIfMatch(t, http.MethodPost, "api/audit/revert?id="+entries[0].ID, `"1"`, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+
+	// Откат изменения возвращает прежний заголовок
+	ret, err := postJSON("api/audit/revert?id="+entries[0].ID, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, "Журнал до", ret["title"])
+	assert.Equal(t, []string{"revert", "update", "create"}, actions(getAudit(t, "task_id="+id)))
+
+	// Создание откатить нельзя
+	status, _, apiErr := errorResponse(t, http.MethodPost, "api/audit/revert?id="+entries[1].ID, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "cannot_revert", apiErr.Code)
+
+	// Удалённая задача возвращается с тем же ID
+	_, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	notFoundTask(t, id)
+	deleted := getAudit(t, "task_id="+id+"&action=delete")
+	if assert.Len(t, deleted, 1) {
+		status, _ = requestIfMatch(t, http.MethodPost, "api/audit/revert?id="+deleted[0].ID, `"3"`, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, status)
+		ret, err = postJSON("api/audit/revert?id="+deleted[0].ID, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Equal(t, id, ret["id"])
+		ret, err = postJSON("api/task?id="+id, nil, http.MethodGet)
+		assert.NoError(t, err)
+		assert.Equal(t, "Журнал до", ret["title"])
+	}
+
+	// Задача из архива не возвращается в scheduler
+	archivedID := addTask(t, task{date: "20950102", title: "Журнал в архиве"})
+	ret, err = postJSON("api/task/done?id="+archivedID, nil, http.MethodPost)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO archive (id, uid, date, title, comment, repeat, status, completed_at, version, archived_at)
+		SELECT id, uid, date, title, comment, repeat, status, completed_at, version, ? FROM scheduler WHERE uid = ?`,
+		time.Now().UTC().Format(time.RFC3339), archivedID)
+	assert.NoError(t, err)
+	_, err = db.Exec("DELETE FROM scheduler WHERE uid = ?", archivedID)
+	assert.NoError(t, err)
+	defer db.Exec("DELETE FROM archive WHERE uid = ?", archivedID)
+
+	done := getAudit(t, "task_id="+archivedID+"&action=done")
+	if assert.Len(t, done, 1) {
+		status, _, apiErr = errorResponse(t, http.MethodPost, "api/audit/revert?id="+done[0].ID, nil)
+		assert.Equal(t, http.StatusConflict, status)
+		assert.Equal(t, "task_archived", apiErr.Code)
+	}
+	notFoundTask(t, archivedID)
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM scheduler WHERE uid = ?", archivedID))
+	assert.Zero(t, count)
+}
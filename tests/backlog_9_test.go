@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func backlogIDs(t *testing.T, url string) map[string]string {
+	body, err := requestJSON(url, nil, http.MethodGet)
+	assert.NoError(t, err)
+
+	var m map[string][]struct {
+		ID   string `json:"id"`
+		Date string `json:"date"`
+	}
+	err = json.Unmarshal(body, &m)
+	assert.NoError(t, err)
+
+	dates := map[string]string{}
+	for _, task := range m["tasks"] {
+		dates[task.ID] = task.Date
+	}
+	return dates
+}
+
+func TestBacklog(t *testing.T) {
+	ret, err := postJSON("api/task", map[string]any{
+		"title":   "Когда-нибудь выучить японский",
+		"backlog": true,
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	id, _ := ret["id"].(string)
+	assert.NotEmpty(t, id)
+
+	ret, err = postJSON("api/task", map[string]any{
+		"title":   "Повторяющаяся без даты",
+		"repeat":  "d 1",
+		"backlog": true,
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	date, ok := backlogIDs(t, "api/tasks?backlog=1")[id]
+	assert.True(t, ok)
+	assert.Empty(t, date)
+	_, ok = backlogIDs(t, "api/tasks")[id]
+	assert.False(t, ok)
+
+	// Задача, прочитанная через GET и отправленная обратно в PUT, остаётся в бэклоге
+	body, err := requestJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, true, got["backlog"])
+	got["comment"] = "Начать с хираганы"
+	ret, err = postJSON("api/task", got, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	date, ok = backlogIDs(t, "api/tasks?backlog=1")[id]
+	assert.True(t, ok)
+	assert.Empty(t, date)
+
+	// Бэклог и дата вместе - ошибка и в POST, и в PUT, как в PATCH
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(`20060102`)
+	status, _, apiErr := errorResponse(t, http.MethodPost, "api/task", map[string]any{
+		"title":   "Бэклог с датой",
+		"date":    tomorrow,
+		"backlog": true,
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_date", apiErr.Code)
+	got["date"] = tomorrow
+	status, _, apiErr = errorResponse(t, http.MethodPut, "api/task", got)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_date", apiErr.Code)
+
+	next := time.Now().AddDate(0, 0, 5).Format(`20060102`)
+	ret, err = postJSON("api/task/schedule?id="+id+"&date="+next, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, next, ret["date"])
+
+	_, ok = backlogIDs(t, "api/tasks?backlog=1")[id]
+	assert.False(t, ok)
+
+	ret, err = postJSON("api/task/schedule?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
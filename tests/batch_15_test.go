@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type apiError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Field   string         `json:"field"`
+	Details map[string]any `json:"details"`
+}
+
+type batchResult struct {
+	Op      string    `json:"op"`
+	ID      string    `json:"id"`
+	Version string    `json:"version"`
+	Status  int       `json:"status"`
+	Error   *apiError `json:"error"`
+}
+
+func postBatch(t *testing.T, req map[string]any) ([]batchResult, *apiError) {
+	body, err := requestJSON("api/tasks/batch", req, http.MethodPost)
+	assert.NoError(t, err)
+
+	var resp struct {
+		Results []batchResult `json:"results"`
+		Error   *apiError     `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &resp))
+	return resp.Results, resp.Error
+}
+
+func TestBatch(t *testing.T) {
+	results, errMsg := postBatch(t, map[string]any{"operations": []map[string]any{
+		{"op": "create", "task": map[string]any{"title": "Пакет 1", "date": "20950101"}},
+		{"op": "create", "task": map[string]any{"title": "Пакет 2", "date": "20950101", "repeat": "d 1"}},
+	}})
+	assert.Nil(t, errMsg)
+	assert.Len(t, results, 2)
+	first, second := results[0].ID, results[1].ID
+	assert.NotEmpty(t, first)
+	assert.NotEmpty(t, second)
+	defer func() {
+		postJSON("api/task?id="+first, nil, http.MethodDelete)
+		postJSON("api/task?id="+second, nil, http.MethodDelete)
+	}()
+
+	// Атомарный пакет с ошибкой не меняет ничего
+	results, errMsg = postBatch(t, map[string]any{"operations": []map[string]any{
+		{"op": "update", "id": first, "task": map[string]any{"title": "Не сохранится", "date": "20950101"}},
+		{"op": "done", "id": "01ZZZZZZZZZZZZZZZZZZZZZZZZ"},
+	}})
+	assert.Empty(t, results)
+	if assert.NotNil(t, errMsg) {
+		assert.Equal(t, "task_not_found", errMsg.Code)
+		assert.Equal(t, float64(1), errMsg.Details["operation"])
+	}
+	ret, err := postJSON("api/task?id="+first, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "Пакет 1", ret["title"])
+
+	// Неатомарный пакет: каждая операция сама по себе
+	results, errMsg = postBatch(t, map[string]any{"atomic": false, "operations": []map[string]any{
+		{"op": "update", "id": first, "version": "1", "task": map[string]any{"title": "Пакет 1 изменён", "date": "20950101"}},
+		{"op": "done", "id": second},
+		{"op": "delete", "id": first, "version": "1"},
+		{"op": "archive", "id": first},
+	}})
+	assert.Nil(t, errMsg)
+	assert.Len(t, results, 4)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.Equal(t, "2", results[0].Version)
+	assert.Equal(t, http.StatusOK, results[1].Status)
+	assert.Equal(t, http.StatusPreconditionFailed, results[2].Status)
+	assert.Equal(t, "version_mismatch", results[2].Error.Code)
+	assert.Equal(t, http.StatusBadRequest, results[3].Status)
+	assert.Equal(t, "invalid_batch", results[3].Error.Code)
+
+	ret, err = postJSON("api/task?id="+first, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "Пакет 1 изменён", ret["title"])
+	ret, err = postJSON("api/task?id="+second, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "20950102", ret["date"])
+}
@@ -12,6 +12,7 @@ import (
 
 type Task struct {
 	ID      int64  `db:"id"`
+	UID     string `db:"uid"`
 	Date    string `db:"date"`
 	Title   string `db:"title"`
 	Comment string `db:"comment"`
@@ -50,7 +51,7 @@ func TestDB(t *testing.T) {
 	id, err := res.LastInsertId()
 
 	var task Task
-	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	err = db.Get(&task, `SELECT id, date, title, comment, repeat FROM scheduler WHERE id=?`, id)
 	assert.NoError(t, err)
 	assert.Equal(t, id, task.ID)
 	assert.Equal(t, `Todo`, task.Title)
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doneIfMatch(id, etag string) (int, error) {
+	resp, _, err := requestHeaders(http.MethodPost, "api/task/done?id="+id, nil, map[string]string{"If-Match": etag})
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+func TestConcurrentDone(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		title:  "Одновременное выполнение",
+		repeat: "d 3",
+	})
+
+	var version int
+	err := db.Get(&version, `SELECT version FROM scheduler WHERE uid=?`, id)
+	assert.NoError(t, err)
+	etag := fmt.Sprintf(`"%d"`, version)
+
+	const n = 10
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, err := doneIfMatch(id, etag)
+			assert.NoError(t, err)
+			codes[i] = code
+		}(i)
+	}
+	wg.Wait()
+
+	var ok, conflict int
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusPreconditionFailed:
+			conflict++
+		}
+	}
+	assert.Equal(t, 1, ok)
+	assert.Equal(t, n-1, conflict)
+
+	var date string
+	err = db.Get(&date, `SELECT date FROM scheduler WHERE uid=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 3).Format(`20060102`), date)
+
+	var completions int
+	err = db.Get(&completions, `SELECT count(*) FROM completions WHERE task_id=(SELECT id FROM scheduler WHERE uid=?)`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, completions)
+}
+
+func TestConcurrentDoneWithoutIfMatch(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	const n = 10
+	run := func(send func() int) []int {
+		codes := make([]int, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = send()
+			}(i)
+		}
+		wg.Wait()
+		return codes
+	}
+	state := func(id string) (string, []string) {
+		var date string
+		assert.NoError(t, db.Get(&date, `SELECT date FROM scheduler WHERE uid=?`, id))
+		var scheduled []string
+		assert.NoError(t, db.Select(&scheduled, `SELECT scheduled_date FROM completions
+			WHERE task_id=(SELECT id FROM scheduler WHERE uid=?) ORDER BY id`, id))
+		return date, scheduled
+	}
+
+	// Повторное нажатие с тем же Idempotency-Key выполняет задачу ровно один раз
+	id := addTask(t, task{title: "Двойной клик", repeat: "d 3"})
+	key := fmt.Sprintf("done-%d", now.UnixNano())
+	for _, code := range run(func() int {
+		resp, _ := postIdempotent(t, "api/task/done?id="+id, key, nil)
+		return resp.StatusCode
+	}) {
+		assert.Contains(t, []int{http.StatusOK, http.StatusConflict}, code)
+	}
+	date, scheduled := state(id)
+	assert.Equal(t, now.AddDate(0, 0, 3).Format(`20060102`), date)
+	assert.Equal(t, []string{now.Format(`20060102`)}, scheduled)
+
+	// Без заголовков каждый запрос - отдельное выполнение: запросы идут по очереди,
+	// и ни одно повторение не засчитывается дважды
+	id = addTask(t, task{title: "Без заголовков", repeat: "d 3"})
+	for _, code := range run(func() int {
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		assert.NoError(t, err)
+		if ret["error"] != nil {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}) {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	date, scheduled = state(id)
+	assert.Equal(t, now.AddDate(0, 0, 3*n).Format(`20060102`), date)
+	want := make([]string, n)
+	for i := range want {
+		want[i] = now.AddDate(0, 0, 3*i).Format(`20060102`)
+	}
+	assert.Equal(t, want, scheduled)
+}
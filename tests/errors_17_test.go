@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// errorResponse - ответ сервера с ошибкой в едином виде
+func errorResponse(t *testing.T, method, apipath string, body any) (int, string, apiError) {
+	resp, data, err := requestHeaders(method, apipath, body, nil)
+	if !assert.NoError(t, err) {
+		return 0, "", apiError{}
+	}
+
+	var ret struct {
+		Error apiError `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &ret))
+	return resp.StatusCode, resp.Header.Get("Content-Type"), ret.Error
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	for _, v := range []struct {
+		method, path string
+		body         any
+		status       int
+		code, field  string
+	}{
+		{http.MethodGet, "api/task", nil, http.StatusBadRequest, "id_required", "id"},
+		{http.MethodGet, "api/task?id=01ZZZZZZZZZZZZZZZZZZZZZZZZ", nil, http.StatusNotFound, "task_not_found", ""},
+		{http.MethodPost, "api/task", map[string]any{"title": ""}, http.StatusBadRequest, "title_required", "title"},
+		{http.MethodPost, "api/task", map[string]any{"title": "Дата", "date": "сегодня"}, http.StatusBadRequest, "invalid_date", "date"},
+		{http.MethodPost, "api/task", map[string]any{"title": "Правило", "repeat": "k 1"}, http.StatusBadRequest, "invalid_repeat", "repeat"},
+		{http.MethodGet, "api/tasks?limit=0", nil, http.StatusBadRequest, "invalid_param", "limit"},
+		{http.MethodGet, "api/tasks?q=due<когда", nil, http.StatusBadRequest, "invalid_query", "q"},
+		{http.MethodPut, "api/task/done", nil, http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{http.MethodGet, "api/no-such-endpoint", nil, http.StatusNotFound, "not_found", ""},
+	} {
+		status, contentType, e := errorResponse(t, v.method, v.path, v.body)
+		assert.Equal(t, v.status, status, v.path)
+		assert.Contains(t, contentType, "application/json", v.path)
+		assert.Equal(t, v.code, e.Code, v.path)
+		assert.Equal(t, v.field, e.Field, v.path)
+		assert.NotEmpty(t, e.Message, v.path)
+	}
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requestIfMatch - запрос с заголовком If-Match, возвращает код ответа и ETag
+func requestIfMatch(t *testing.T, method, apipath, etag string, body any) (int, string) {
+	resp, _, err := requestHeaders(method, apipath, body, map[string]string{"If-Match": etag})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
+
+func TestIfMatch(t *testing.T) {
+	id := addTask(t, task{date: "20930101", title: "Версия 1"})
+	defer postJSON("api/task?id="+id, nil, http.MethodDelete)
+
+	update := func(title string) map[string]any {
+		return map[string]any{"id": id, "date": "20930101", "title": title}
+	}
+	status, etag := requestIfMatch(t, http.MethodPut, "api/task", `"1"`, update("Версия 2"))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `"2"`, etag)
+
+	// Устаревшая версия и слабый ETag текущей версии не подходят
+	for _, stale := range []string{`"1"`, `W/"2"`, `W/"2", "1"`, `2`} {
+		status, _ = requestIfMatch(t, http.MethodPut, "api/task", stale, update("Чужая правка"))
+		assert.Equal(t, http.StatusPreconditionFailed, status, "PUT If-Match: %s", stale)
+		status, _ = requestIfMatch(t, http.MethodDelete, "api/task?id="+id, stale, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, status, "DELETE If-Match: %s", stale)
+	}
+	ret, err := postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "Версия 2", ret["title"])
+
+	// Подходит любой из перечисленных ETag и "*"
+	status, _ = requestIfMatch(t, http.MethodPut, "api/task", `"1", "2"`, update("Версия 3"))
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = requestIfMatch(t, http.MethodPut, "api/task", `*`, update("Версия 4"))
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = requestIfMatch(t, http.MethodDelete, "api/task?id="+id, `"4"`, nil)
+	assert.Equal(t, http.StatusOK, status)
+	notFoundTask(t, id)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func titles(page tasksPage) []string {
+	var ret []string
+	for _, task := range page.Tasks {
+		ret = append(ret, task["title"].(string))
+	}
+	return ret
+}
+
+func TestTasksFilters(t *testing.T) {
+	var ids []string
+	for _, v := range []task{
+		{date: "20970105", title: "Банан", repeat: "d 3"},
+		{date: "20970103", title: "Апельсин"},
+		{date: "20970103", title: "Вишня", repeat: "y"},
+		{date: "20970110", title: "Груша", repeat: "d 7"},
+	} {
+		ids = append(ids, addTask(t, v))
+	}
+	defer func() {
+		for _, id := range ids {
+			postJSON("api/task?id="+id, nil, http.MethodDelete)
+		}
+	}()
+
+	page := getPage(t, url.Values{"from": {"20970101"}, "to": {"20970105"}})
+	assert.Equal(t, []string{"Апельсин", "Вишня", "Банан"}, titles(page))
+
+	page = getPage(t, url.Values{"from": {"20970101"}, "to": {"20971231"}, "has_repeat": {"1"}, "repeat_kind": {"d"}, "count": {"1"}})
+	assert.Equal(t, []string{"Банан", "Груша"}, titles(page))
+	assert.Equal(t, 2, page.Total)
+
+	page = getPage(t, url.Values{"from": {"20970101"}, "to": {"20971231"}, "has_repeat": {"0"}})
+	assert.Equal(t, []string{"Апельсин"}, titles(page))
+
+	// Сортировка по заголовку в обратном порядке, по две задачи на странице
+	query := url.Values{"from": {"20970101"}, "to": {"20971231"}, "sort": {"title"}, "order": {"desc"}, "limit": {"2"}}
+	var seen []string
+	for pages := 0; pages < 10; pages++ {
+		page := getPage(t, query)
+		seen = append(seen, titles(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	assert.Equal(t, []string{"Груша", "Вишня", "Банан", "Апельсин"}, seen)
+
+	// Курсор от другой сортировки не принимается
+	query.Set("cursor", getPage(t, url.Values{"from": {"20970101"}, "limit": {"1"}}).NextCursor)
+	ret, err := requestJSON("api/tasks?"+query.Encode(), nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Contains(t, string(ret), "error")
+
+	for _, bad := range []url.Values{
+		{"from": {"2097"}},
+		{"sort": {"priority"}},
+		{"order": {"up"}},
+		{"has_repeat": {"yes"}},
+		{"repeat_kind": {"x"}},
+	} {
+		ret, err := requestJSON("api/tasks?"+bad.Encode(), nil, http.MethodGet)
+		assert.NoError(t, err)
+		assert.Contains(t, string(ret), "error", bad.Encode())
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scoredTask struct {
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+func getFuzzy(t *testing.T, search string) []scoredTask {
+	query := url.Values{"search": {search}, "fuzzy": {"1"}}
+	body, err := requestJSON("api/tasks?"+query.Encode(), nil, http.MethodGet)
+	require.NoError(t, err)
+	var page struct {
+		Tasks []scoredTask `json:"tasks"`
+	}
+	require.NoError(t, json.Unmarshal(body, &page), string(body))
+	return page.Tasks
+}
+
+func TestFuzzySearch(t *testing.T) {
+	var ids []string
+	for _, v := range []task{
+		{date: "20960401", title: "Оплатить квитанцию"},
+		{date: "20960402", title: "Квитанция за свет"},
+		{date: "20960403", title: "Позвонить Виталию"},
+	} {
+		ids = append(ids, addTask(t, v))
+	}
+	defer func() {
+		for _, id := range ids {
+			postJSON("api/task?id="+id, nil, http.MethodDelete)
+		}
+	}()
+
+	// Обычный поиск опечатку не прощает
+	assert.Empty(t, getPage(t, url.Values{"search": {"квитнция"}}).Tasks)
+
+	// Нечёткий находит оба заголовка, ближе по написанию - выше
+	tasks := getFuzzy(t, "квитнция")
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "Квитанция за свет", tasks[0].Title)
+	assert.Equal(t, "Оплатить квитанцию", tasks[1].Title)
+	assert.InDelta(t, 1-1.0/9, tasks[0].Score, 1e-9)
+	assert.InDelta(t, 1-2.0/9, tasks[1].Score, 1e-9)
+	assert.Greater(t, tasks[0].Score, tasks[1].Score)
+
+	// «Виталию» делит с запросом триграмму «вит», но сходство ниже порога
+	for _, task := range tasks {
+		assert.NotEqual(t, "Позвонить Виталию", task.Title)
+		assert.GreaterOrEqual(t, task.Score, 0.6)
+	}
+
+	// Начало слова - полное совпадение
+	tasks = getFuzzy(t, "витал")
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Позвонить Виталию", tasks[0].Title)
+	assert.Equal(t, 1.0, tasks[0].Score)
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type completion struct {
+	ID            string `json:"id"`
+	TaskID        string `json:"task_id"`
+	ScheduledDate string `json:"scheduled_date"`
+	CompletedAt   string `json:"completed_at"`
+}
+
+func getHistory(t *testing.T, id string) []completion {
+	body, err := requestJSON("api/task/history?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	var resp struct {
+		History []completion `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(body, &resp), string(body))
+	return resp.History
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Now()
+	id := addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Полить цветы",
+		repeat: "d 3",
+	})
+	assert.Empty(t, getHistory(t, id))
+
+	done := func() {
+		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		require.NoError(t, err)
+		require.Empty(t, ret)
+	}
+	done()
+	done()
+
+	history := getHistory(t, id)
+	require.Len(t, history, 2)
+	for _, c := range history {
+		assert.Equal(t, id, c.TaskID)
+		_, err := time.Parse(time.RFC3339, c.CompletedAt)
+		assert.NoError(t, err, c.CompletedAt)
+	}
+	// Записи идут в порядке выполнения: сначала сегодняшнее повторение,
+	// затем перенесённое правилом на 3 дня вперёд
+	assert.Equal(t, now.Format(`20060102`), history[0].ScheduledDate)
+	assert.Equal(t, now.AddDate(0, 0, 3).Format(`20060102`), history[1].ScheduledDate)
+	// completed_at хранится с точностью до секунды, при равном времени порядок задаёт id
+	assert.LessOrEqual(t, history[0].CompletedAt, history[1].CompletedAt)
+	first, err := strconv.Atoi(history[0].ID)
+	require.NoError(t, err)
+	second, err := strconv.Atoi(history[1].ID)
+	require.NoError(t, err)
+	assert.Less(t, first, second)
+
+	// Без id - ошибка, у неизвестной задачи истории нет
+	status, _, apiErr := errorResponse(t, http.MethodGet, "api/task/history", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "id_required", apiErr.Code)
+	assert.Empty(t, getHistory(t, "99999999"))
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// postIdempotent - POST с заголовком Idempotency-Key
+func postIdempotent(t *testing.T, apipath, key string, body any) (*http.Response, map[string]any) {
+	resp, data, err := requestHeaders(http.MethodPost, apipath, body, map[string]string{"Idempotency-Key": key})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var ret map[string]any
+	assert.NoError(t, json.Unmarshal(data, &ret))
+	return resp, ret
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	// Ключи живут сутки, поэтому у каждого запуска теста свои
+	prefix := fmt.Sprintf("test-%d-", time.Now().UnixNano())
+	task := map[string]any{"date": "20940101", "title": "Одна задача", "repeat": "d 2"}
+
+	resp, ret := postIdempotent(t, "api/task", prefix+"create", task)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	id, _ := ret["id"].(string)
+	if !assert.NotEmpty(t, id) {
+		return
+	}
+	defer postJSON("api/task?id="+id, nil, http.MethodDelete)
+
+	// Повтор возвращает тот же ответ и не создаёт вторую задачу
+	resp, ret = postIdempotent(t, "api/task", prefix+"create", task)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, id, ret["id"])
+
+	// Тот же ключ с другим телом - ошибка
+	resp, ret = postIdempotent(t, "api/task", prefix+"create", map[string]any{"title": "Другая задача"})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "idempotency_key_reused", ret["error"].(map[string]any)["code"])
+
+	// Повторное выполнение не сдвигает повторяющуюся задачу ещё раз
+	for i := 0; i < 2; i++ {
+		resp, _ = postIdempotent(t, "api/task/done?id="+id, prefix+"done", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	body, err := requestJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, "20940103", got["date"])
+
+	// Ключ, занятый запросом без ответа, освобождается только по истечении срока запроса
+	db := openDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM idempotency_keys WHERE key LIKE ?", prefix+"%")
+	data, err := json.Marshal(task)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(append([]byte("POST /api/task\n"), data...))
+	for _, v := range []struct {
+		key    string
+		age    time.Duration
+		status int
+	}{
+		{prefix + "running", 0, http.StatusConflict},
+		{prefix + "abandoned", time.Hour, http.StatusOK},
+	} {
+		_, err = db.Exec("INSERT INTO idempotency_keys (key, fingerprint, created_at) VALUES (?, ?, ?)",
+			v.key, hex.EncodeToString(sum[:]), time.Now().Add(-v.age).Format(time.RFC3339))
+		assert.NoError(t, err)
+		resp, ret = postIdempotent(t, "api/task", v.key, task)
+		assert.Equal(t, v.status, resp.StatusCode, v.key)
+		if resp.StatusCode == http.StatusOK {
+			assert.NotEqual(t, id, ret["id"])
+			postJSON("api/task?id="+fmt.Sprint(ret["id"]), nil, http.MethodDelete)
+		} else {
+			assert.Equal(t, "idempotency_in_progress", ret["error"].(map[string]any)["code"])
+		}
+	}
+
+	resp, ret = postIdempotent(t, "api/task", "ключ с пробелом", task)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_param", ret["error"].(map[string]any)["code"])
+}
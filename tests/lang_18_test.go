@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// langError - ошибка на запрос GET /api/task без id с заголовком Accept-Language
+func langError(t *testing.T, acceptLanguage string) (string, apiError) {
+	var header map[string]string
+	if acceptLanguage != "" {
+		header = map[string]string{"Accept-Language": acceptLanguage}
+	}
+	resp, data, err := requestHeaders(http.MethodGet, "api/task", nil, header)
+	if !assert.NoError(t, err) {
+		return "", apiError{}
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var ret struct {
+		Error apiError `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &ret))
+	return resp.Header.Get("Content-Language"), ret.Error
+}
+
+func TestErrorLanguage(t *testing.T) {
+	for _, v := range []struct {
+		header, lang, message string
+	}{
+		{"", "ru", "ID не указан"},
+		{"en", "en", "ID is required"},
+		{"en-US,en;q=0.9", "en", "ID is required"},
+		{"de-DE, en;q=0.5, ru;q=0.8", "ru", "ID не указан"},
+		{"fr", "ru", "ID не указан"},
+	} {
+		lang, e := langError(t, v.header)
+		assert.Equal(t, v.lang, lang, v.header)
+		// Код ошибки не зависит от языка
+		assert.Equal(t, "id_required", e.Code, v.header)
+		assert.Equal(t, v.message, e.Message, v.header)
+	}
+}
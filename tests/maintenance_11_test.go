@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	id := addTask(t, task{title: "Задача до обслуживания"})
+
+	ret, err := postJSON("api/admin/maintenance", map[string]any{"enabled": true}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, true, ret["maintenance"])
+	defer postJSON("api/admin/maintenance", map[string]any{"enabled": false}, http.MethodPost)
+
+	// Изменения отклоняются с 503, кодом maintenance и подсказкой, когда повторить
+	for _, v := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, "api/task", map[string]any{"title": "Не должна создаться"}},
+		{http.MethodPost, "api/task/done?id=" + id, nil},
+		{http.MethodDelete, "api/task?id=" + id, nil},
+	} {
+		resp, data, err := requestHeaders(v.method, v.path, v.body, nil)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, v.path)
+		assert.Equal(t, "60", resp.Header.Get("Retry-After"), v.path)
+		var ret struct {
+			Error apiError `json:"error"`
+		}
+		assert.NoError(t, json.Unmarshal(data, &ret))
+		assert.Equal(t, "maintenance", ret.Error.Code, v.path)
+	}
+
+	ret, err = postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, id, ret["id"])
+
+	ret, err = postJSON("api/admin/maintenance", map[string]any{"enabled": false}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, false, ret["maintenance"])
+
+	ret, err = postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+}
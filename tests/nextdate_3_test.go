@@ -31,6 +31,7 @@ func TestNextDate(t *testing.T) {
 		{"20240301", "y", `20250301`},
 		{"20240113", "d", ""},
 		{"20240113", "d 7", `20240127`},
+		{"20240113", "d 7 junk", ""},
 		{"20240120", "d 20", `20240209`},
 		{"20240202", "d 30", `20240303`},
 		{"20240320", "d 401", ""},
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	body, err := getBody("api/openapi.json")
+	assert.NoError(t, err)
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &spec))
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3."), spec.OpenAPI)
+
+	// Описаны все адреса, с которыми работают клиенты
+	for path, methods := range map[string][]string{
+		"/api/signin":    {"post"},
+		"/api/nextdate":  {"get"},
+		"/api/task":      {"get", "post", "put", "patch", "delete"},
+		"/api/tasks":     {"get"},
+		"/api/task/done": {"post"},
+	} {
+		for _, method := range methods {
+			assert.Contains(t, spec.Paths[path], method, path)
+		}
+	}
+
+	// Каждый описанный метод отвечает сам, а не ошибкой "нет адреса" или "метод не поддерживается".
+	// Запросы без параметров и тела ничего не меняют.
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for path, item := range spec.Paths {
+		for method := range item {
+			resp, data, err := requestHeaders(strings.ToUpper(method), strings.TrimPrefix(param.ReplaceAllString(path, "x"), "/"), nil, nil)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			var ret struct {
+				Error apiError `json:"error"`
+			}
+			json.Unmarshal(data, &ret)
+			assert.NotEqual(t, http.StatusMethodNotAllowed, resp.StatusCode, method+" "+path)
+			assert.NotEqual(t, "not_found", ret.Error.Code, method+" "+path)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tasksPage struct {
+	Tasks      []map[string]any `json:"tasks"`
+	NextCursor string           `json:"next_cursor"`
+	Total      int              `json:"total"`
+}
+
+func getPage(t *testing.T, query url.Values) tasksPage {
+	body, err := requestJSON("api/tasks?"+query.Encode(), nil, http.MethodGet)
+	assert.NoError(t, err)
+
+	var page tasksPage
+	err = json.Unmarshal(body, &page)
+	assert.NoError(t, err)
+	return page
+}
+
+func TestTasksPages(t *testing.T) {
+	// У всех задач одна дата: порядок внутри даты тоже должен быть устойчивым
+	var ids []string
+	for _, title := range []string{"Первая", "Вторая", "Третья", "Четвёртая", "Пятая"} {
+		ids = append(ids, addTask(t, task{date: "20980101", title: title}))
+	}
+	defer func() {
+		for _, id := range ids {
+			postJSON("api/task?id="+id, nil, http.MethodDelete)
+		}
+	}()
+
+	query := url.Values{"search": {"01.01.2098"}, "limit": {"2"}, "count": {"1"}}
+	var seen []string
+	for pages := 0; pages < 10; pages++ {
+		page := getPage(t, query)
+		assert.Equal(t, 5, page.Total)
+		assert.LessOrEqual(t, len(page.Tasks), 2)
+		for _, task := range page.Tasks {
+			seen = append(seen, task["id"].(string))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	assert.Equal(t, ids, seen)
+
+	query.Set("cursor", "не курсор")
+	body, err := requestJSON("api/tasks?"+query.Encode(), nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.NotEmpty(t, m["error"])
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchTask(t *testing.T) {
+	id := addTask(t, task{date: "20940101", title: "Частичная правка", comment: "Не трогать", repeat: "d 2"})
+	defer postJSON("api/task?id="+id, nil, http.MethodDelete)
+
+	// Меняется только заголовок, комментарий и правило остаются прежними
+	ret, err := postJSON("api/task?id="+id, map[string]any{"title": "Новый заголовок"}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Equal(t, "Новый заголовок", ret["title"])
+	assert.Equal(t, "Не трогать", ret["comment"])
+	assert.Equal(t, "20940101", ret["date"])
+	assert.Equal(t, "d 2", ret["repeat"])
+
+	ret, err = postJSON("api/task?id="+id, map[string]any{"comment": nil, "repeat": map[string]any{"kind": "d", "interval": 5}}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Equal(t, "", ret["comment"])
+	assert.Equal(t, "d 5", ret["repeat"])
+
+	// Повторяющаяся задача не может остаться без даты
+	for _, patch := range []map[string]any{
+		{"date": nil},
+		{"title": nil},
+		{"title": ""},
+		{"date": "2094"},
+		{"repeat": "ууу"},
+		{"status": "completed"},
+	} {
+		ret, err = postJSON("api/task?id="+id, patch, http.MethodPatch)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], patch)
+	}
+
+	ret, err = postJSON("api/task?id="+id, map[string]any{"date": nil, "repeat": nil}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Equal(t, "", ret["date"])
+	assert.Equal(t, "", ret["repeat"])
+	assert.Equal(t, "Новый заголовок", ret["title"])
+
+	ret, err = postJSON("api/task?id=01ZZZZZZZZZZZZZZZZZZZZZZZZ", map[string]any{"title": "Нет такой"}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
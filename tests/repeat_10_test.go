@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepeatRule(t *testing.T) {
+	ret, err := postJSON("api/task", map[string]any{
+		"title":  "Полить цветы",
+		"repeat": map[string]any{"kind": "d", "interval": 4},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	id, _ := ret["id"].(string)
+	assert.NotEmpty(t, id)
+
+	body, err := requestJSON("api/task?id="+id+"", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var task struct {
+		Repeat     string `json:"repeat"`
+		RepeatRule struct {
+			Kind     string `json:"kind"`
+			Interval int    `json:"interval"`
+		} `json:"repeat_rule"`
+	}
+	err = json.Unmarshal(body, &task)
+	assert.NoError(t, err)
+	assert.Equal(t, "d 4", task.Repeat)
+	assert.Equal(t, "d", task.RepeatRule.Kind)
+	assert.Equal(t, 4, task.RepeatRule.Interval)
+
+	// Разобранное правило есть и в списке, без дополнительных параметров
+	var listed map[string]any
+	for _, v := range getPage(t, url.Values{"search": {"Полить цветы"}, "limit": {"500"}}).Tasks {
+		if v["id"] == id {
+			listed = v
+		}
+	}
+	assert.Equal(t, map[string]any{"kind": "d", "interval": 4.0}, listed["repeat_rule"])
+
+	for _, rule := range []map[string]any{
+		{"kind": "d", "interval": 0},
+		{"kind": "d", "interval": 401},
+		{"kind": "q"},
+		{"kind": "m", "days": []int{-1, 18}, "months": []int{1, 6}},
+		{"kind": "w", "days": []int{1, 4}},
+		{"kind": "d", "interval": 7, "days": []int{1}},
+	} {
+		ret, err = postJSON("api/task", map[string]any{
+			"title":  "Неправильное правило",
+			"repeat": rule,
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], "Ожидается ошибка для правила %v", rule)
+	}
+
+	// Строка проверяется тем же разбором, что и при выполнении задачи
+	for _, repeat := range []string{"d 7 junk", "d", "y 1", "w 1,4", "m -1,18 1,6"} {
+		ret, err = postJSON("api/task", map[string]any{
+			"title":  "Неправильное правило",
+			"repeat": repeat,
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], "Ожидается ошибка для правила %q", repeat)
+	}
+
+	// Лишние пробелы убираются, правило хранится в одном виде
+	ret, err = postJSON("api/task", map[string]any{
+		"title":  "Полить цветы ещё раз",
+		"repeat": " d  7 ",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	id2, _ := ret["id"].(string)
+	assert.NotEmpty(t, id2)
+	body, err = requestJSON("api/task?id="+id2+"", nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(body, &task))
+	assert.Equal(t, "d 7", task.Repeat)
+	assert.Equal(t, 7, task.RepeatRule.Interval)
+
+	for _, taskID := range []string{id, id2} {
+		postJSON("api/task?id="+taskID, nil, http.MethodDelete)
+	}
+
+	// Фильтры предлагают только поддерживаемые правила
+	for _, query := range []string{"repeat_kind=w", "repeat_kind=m", "q=repeat:w"} {
+		status, _, apiErr := errorResponse(t, http.MethodGet, "api/tasks?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+		assert.NotEmpty(t, apiErr.Code, query)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	var ids []string
+	for _, v := range []task{
+		{date: "20960301", title: "Созвон с бухгалтерией", comment: "Обсудить квартальный отчёт"},
+		{date: "20960302", title: "Отчёт для налоговой", comment: "созвониться после обеда"},
+		{date: "20960303", title: "Купить хлеб"},
+	} {
+		ids = append(ids, addTask(t, v))
+	}
+	defer func() {
+		for _, id := range ids {
+			postJSON("api/task?id="+id, nil, http.MethodDelete)
+		}
+	}()
+
+	// Регистр кириллицы не важен
+	for _, search := range []string{"Созвон", "созвон", "СОЗВОН"} {
+		page := getPage(t, url.Values{"search": {search}, "sort": {"date"}})
+		assert.Equal(t, []string{"Созвон с бухгалтерией", "Отчёт для налоговой"}, titles(page), search)
+	}
+
+	// Каждое слово ищется по префиксу, все слова должны встретиться
+	page := getPage(t, url.Values{"search": {"бухгалт квартальн"}})
+	assert.Equal(t, []string{"Созвон с бухгалтерией"}, titles(page))
+	page = getPage(t, url.Values{"search": {"бухгалт хлеб"}})
+	assert.Empty(t, page.Tasks)
+
+	// Найденные слова подсвечены
+	page = getPage(t, url.Values{"search": {"бухгалт"}})
+	if assert.Len(t, page.Tasks, 1) {
+		assert.Equal(t, "Созвон с <mark>бухгалтерией</mark>", page.Tasks[0]["title_snippet"])
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"testing"
 	"time"
 
@@ -28,14 +27,15 @@ func TestTask(t *testing.T) {
 
 	body, err := requestJSON("api/task", nil, http.MethodGet)
 	assert.NoError(t, err)
-	var m map[string]string
-	err = json.Unmarshal(body, &m)
+	var merr map[string]any
+	err = json.Unmarshal(body, &merr)
 	assert.NoError(t, err)
 
-	e, ok := m["error"]
+	e, ok := merr["error"]
 	assert.False(t, !ok || len(fmt.Sprint(e)) == 0,
 		"Ожидается ошибка для вызова /api/task")
 
+	var m map[string]any
 	body, err = requestJSON("api/task?id="+todo, nil, http.MethodGet)
 	assert.NoError(t, err)
 	err = json.Unmarshal(body, &m)
@@ -103,10 +103,10 @@ func TestEditTask(t *testing.T) {
 		assert.False(t, ok && fmt.Sprint(e) != "")
 
 		var task Task
-		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		err = db.Get(&task, `SELECT id, uid, date, title, comment, repeat FROM scheduler WHERE uid=?`, id)
 		assert.NoError(t, err)
 
-		assert.Equal(t, id, strconv.FormatInt(task.ID, 10))
+		assert.Equal(t, id, task.UID)
 		assert.Equal(t, newVals["title"], task.Title)
 		if _, is := newVals["comment"]; !is {
 			newVals["comment"] = ""
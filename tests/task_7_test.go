@@ -32,7 +32,18 @@ func TestDone(t *testing.T) {
 	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
-	notFoundTask(t, id)
+
+	var status string
+	err = db.Get(&status, `SELECT status FROM scheduler WHERE uid=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", status)
+
+	ret, err = postJSON("api/task/undone?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	err = db.Get(&status, `SELECT status FROM scheduler WHERE uid=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "open", status)
 
 	id = addTask(t, task{
 		title:  "Проверить работу /api/task/done",
@@ -45,7 +56,7 @@ func TestDone(t *testing.T) {
 		assert.Empty(t, ret)
 
 		var task Task
-		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		err = db.Get(&task, `SELECT id, date, title, comment, repeat FROM scheduler WHERE uid=?`, id)
 		assert.NoError(t, err)
 		now = now.AddDate(0, 0, 3)
 		assert.Equal(t, task.Date, now.Format(`20060102`))
@@ -24,7 +24,7 @@ func addTask(t *testing.T, task task) string {
 	return id
 }
 
-func getTasks(t *testing.T, search string) []map[string]string {
+func getTasks(t *testing.T, search string) []map[string]any {
 	url := "api/tasks"
 	if Search {
 		url += "?search=" + search
@@ -32,7 +32,7 @@ func getTasks(t *testing.T, search string) []map[string]string {
 	body, err := requestJSON(url, nil, http.MethodGet)
 	assert.NoError(t, err)
 
-	var m map[string][]map[string]string
+	var m map[string][]map[string]any
 	err = json.Unmarshal(body, &m)
 	assert.NoError(t, err)
 	return m["tasks"]
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requestV2 - запрос к API v2; возвращает ответ и разобранное тело, если оно есть
+func requestV2(t *testing.T, method, apipath string, body any) (*http.Response, map[string]any) {
+	resp, data, err := requestHeaders(method, apipath, body, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var ret map[string]any
+	if resp.StatusCode != http.StatusNoContent {
+		assert.NoError(t, json.Unmarshal(data, &ret))
+	}
+	return resp, ret
+}
+
+func TestTasksV2(t *testing.T) {
+	resp, ret := requestV2(t, http.MethodPost, "api/v2/tasks", map[string]any{
+		"date": "20940101", "title": "Задача v2", "repeat": "d 3",
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	id, _ := ret["id"].(string)
+	if !assert.NotEmpty(t, id) {
+		return
+	}
+	path := "api/v2/tasks/" + id
+	assert.Equal(t, "/"+path, resp.Header.Get("Location"))
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	resp, ret = requestV2(t, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Задача v2", ret["title"])
+
+	// ID берётся из пути, в теле его можно не указывать
+	resp, ret = requestV2(t, http.MethodPut, path, map[string]any{"date": "20940102", "title": "Замена v2", "repeat": "d 3"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Замена v2", ret["title"])
+	assert.Equal(t, "20940102", ret["date"])
+
+	resp, ret = requestV2(t, http.MethodPut, path, map[string]any{"id": "другой", "title": "Чужой ID"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "id_mismatch", ret["error"].(map[string]any)["code"])
+
+	resp, ret = requestV2(t, http.MethodPatch, path, map[string]any{"comment": "Правка v2"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Правка v2", ret["comment"])
+	assert.Equal(t, "Замена v2", ret["title"])
+
+	// Повторяющаяся задача после выполнения переносится, новая дата - в ответе
+	resp, ret = requestV2(t, http.MethodPost, path+"/done", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "20940105", ret["date"])
+
+	resp, ret = requestV2(t, http.MethodGet, path+"/done", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "POST", resp.Header.Get("Allow"))
+	assert.Equal(t, "method_not_allowed", ret["error"].(map[string]any)["code"])
+
+	resp, _ = requestV2(t, http.MethodDelete, path, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, ret = requestV2(t, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "task_not_found", ret["error"].(map[string]any)["code"])
+}
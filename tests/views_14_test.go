@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryViews(t *testing.T) {
+	var ids []string
+	for _, v := range []task{
+		{date: "20960105", title: "Годовой отчёт", comment: "черновик", repeat: "d 3"},
+		{date: "20960103", title: "Квартальный отчёт", comment: "финал"},
+		{date: "20960110", title: "Купить хлеб", repeat: "y"},
+	} {
+		ids = append(ids, addTask(t, v))
+	}
+	defer func() {
+		for _, id := range ids {
+			postJSON("api/task?id="+id, nil, http.MethodDelete)
+		}
+	}()
+
+	page := getPage(t, url.Values{"q": {`due>=20960101 "ОТЧЁТ" -comment:черновик`}})
+	assert.Equal(t, []string{"Квартальный отчёт"}, titles(page))
+
+	page = getPage(t, url.Values{"q": {"due>=20960101 due<20960106 -repeat:none"}})
+	assert.Equal(t, []string{"Годовой отчёт"}, titles(page))
+
+	page = getPage(t, url.Values{"q": {"due>=20960101 repeat:y"}})
+	assert.Equal(t, []string{"Купить хлеб"}, titles(page))
+
+	for _, bad := range []string{"due<когда-нибудь", `"без кавычки`, "repeat:q", "title<5"} {
+		ret, err := requestJSON("api/tasks?"+url.Values{"q": {bad}}.Encode(), nil, http.MethodGet)
+		assert.NoError(t, err)
+		assert.Contains(t, string(ret), "error", bad)
+	}
+
+	// Сохранённый список
+	ret, err := postJSON("api/views", map[string]any{"name": "Отчёты 2096", "query": "due>=20960101 отчёт"}, http.MethodPost)
+	assert.NoError(t, err)
+	viewID, _ := ret["id"].(string)
+	assert.NotEmpty(t, viewID)
+	defer postJSON("api/views?id="+viewID, nil, http.MethodDelete)
+
+	ret, err = postJSON("api/views", map[string]any{"name": "Отчёты 2096", "query": "отчёт"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	ret, err = postJSON("api/views", map[string]any{"name": "С ошибкой", "query": "due<xx"}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+
+	page = getPage(t, url.Values{"view": {viewID}})
+	assert.Equal(t, []string{"Квартальный отчёт", "Годовой отчёт"}, titles(page))
+
+	ret, err = postJSON("api/views", map[string]any{"id": viewID, "name": "Отчёты 2096", "query": "due>=20960101 отчёт repeat:none"}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Equal(t, "Отчёты 2096", ret["name"])
+
+	page = getPage(t, url.Values{"view": {viewID}})
+	assert.Equal(t, []string{"Квартальный отчёт"}, titles(page))
+
+	ret, err = postJSON("api/views?id="+viewID, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	ret, err = postJSON("api/views?id="+viewID, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ret["error"])
+}
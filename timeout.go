@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultReadTimeout    = 15 * time.Second  // Сколько ждём заголовки и тело запроса
+	defaultWriteTimeout   = 30 * time.Second  // Сколько можно отдавать ответ
+	defaultIdleTimeout    = 120 * time.Second // Сколько держим keep-alive соединение без запросов
+	defaultRequestTimeout = 20 * time.Second  // Срок обработки одного запроса, должен быть меньше defaultWriteTimeout
+)
+
+// deadlineExempt - маршруты без срока запроса: снимок большой базы
+// может отдаваться дольше любого разумного срока
+var deadlineExempt = map[string]bool{
+	"/api/admin/backup": true,
+}
+
+// withDeadline - ограничивает время обработки запроса.
+// Контекст запроса отменяется по истечении timeout, все запросы к базе с этим контекстом
+// прерываются, а обработчик отвечает 503 через writeError. Ноль отключает ограничение.
+func withDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deadlineExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
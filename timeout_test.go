@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	openTestDB(t)
+
+	// Срок истёк раньше, чем обработчик дошёл до базы - 503 timeout
+	rec := serve(t, withDeadline(http.HandlerFunc(tasksHandler), time.Nanosecond), http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	code, _ := apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeTimeout, code)
+
+	// С нормальным сроком запрос проходит
+	rec = serve(t, withDeadline(http.HandlerFunc(tasksHandler), time.Minute), http.MethodGet, "/api/tasks", nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Клиент ушёл - запрос к базе прерван, в лог попадает 499
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil).WithContext(ctx)
+	rec = httptest.NewRecorder()
+	withDeadline(http.HandlerFunc(tasksHandler), time.Minute).ServeHTTP(rec, req)
+	assert.Equal(t, statusClientClosedRequest, rec.Code)
+	code, _ = apiErrorOf(t, decodeJSON(t, rec))
+	assert.Equal(t, CodeCanceled, code)
+}
+
+func TestBackupWithoutDeadline(t *testing.T) {
+	openTestDB(t)
+
+	var hasDeadline bool
+	probe := withDeadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline = r.Context().Deadline()
+	}), time.Minute)
+	serve(t, probe, http.MethodGet, "/api/tasks", nil)
+	assert.True(t, hasDeadline)
+	serve(t, probe, http.MethodGet, "/api/admin/backup", nil)
+	assert.False(t, hasDeadline)
+
+	// Снимок отдаётся, даже если срок обычного запроса давно бы истёк
+	rec := serve(t, withDeadline(http.HandlerFunc(backupHandler), time.Nanosecond), http.MethodGet, "/api/admin/backup", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/vnd.sqlite3", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+// crockford - алфавит base32 Крокфорда, которым записывается ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID - создаёт ULID: 48 бит времени в миллисекундах и 80 случайных бит, 26 символов.
+// ULID уникален без общего счётчика, поэтому задачи из разных баз не пересекаются,
+// а сортировка по нему совпадает с порядком создания.
+func newULID(t time.Time) string {
+	var data [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		data[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(data[6:]); err != nil {
+		panic(err) // crypto/rand не возвращает ошибок на поддерживаемых системах
+	}
+
+	// 128 бит разбиваются на 26 групп по 5 бит, первая группа - старшие 3 бита
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		bit := 128 - 5*(26-i)
+		out[i] = crockford[uint5(data, bit)]
+	}
+	return string(out)
+}
+
+// uint5 - пять бит из data, начиная с бита start (биты считаются со старшего).
+// Биты левее начала данных считаются нулями.
+func uint5(data [16]byte, start int) byte {
+	var v byte
+	for b := start; b < start+5; b++ {
+		v <<= 1
+		if b >= 0 && data[b/8]&(0x80>>(b%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// isULID - похожа ли строка на ULID
+func isULID(s string) bool {
+	if len(s) != 26 || s[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune(crockford, rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API v2: ID задачи всегда в пути, действие определяется методом.
+// Маршруты задаются шаблонами http.ServeMux из Go 1.22, например "GET /api/v2/tasks/{id}".
+// v1 (/api/task?id=) остаётся для веб-интерфейса.
+
+// v2TaskPath - адрес задачи в API v2, его отдаём в Location
+func v2TaskPath(id string) string {
+	return "/api/v2/tasks/" + id
+}
+
+// registerV2Routes - маршруты API v2. Для адресов без подходящего метода
+// отвечает allowMethods, иначе ServeMux ответил бы 405 простым текстом.
+func registerV2Routes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v2/tasks", authMiddleware(tasksHandler))
+	mux.HandleFunc("POST /api/v2/tasks", authMiddleware(withIdempotency(createTaskV2)))
+	mux.HandleFunc("/api/v2/tasks", allowMethods(http.MethodGet, http.MethodPost))
+
+	mux.HandleFunc("GET /api/v2/tasks/{id}", authMiddleware(getTaskV2))
+	mux.HandleFunc("PUT /api/v2/tasks/{id}", authMiddleware(replaceTaskV2))
+	mux.HandleFunc("PATCH /api/v2/tasks/{id}", authMiddleware(patchTaskV2))
+	mux.HandleFunc("DELETE /api/v2/tasks/{id}", authMiddleware(deleteTaskV2))
+	mux.HandleFunc("/api/v2/tasks/{id}", allowMethods(http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete))
+
+	mux.HandleFunc("POST /api/v2/tasks/{id}/done", authMiddleware(withIdempotency(doneTaskV2)))
+	mux.HandleFunc("/api/v2/tasks/{id}/done", allowMethods(http.MethodPost))
+}
+
+// allowMethods - ответ 405 с заголовком Allow для остальных методов
+func allowMethods(methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+	}
+}
+
+// writeTaskV2 - отдаёт задачу с её версией в ETag
+func writeTaskV2(w http.ResponseWriter, status int, task *Task) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", taskETag(task.Version))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(task)
+}
+
+// createTaskV2 - POST /api/v2/tasks: 201, адрес задачи в Location и сама задача в теле
+func createTaskV2(w http.ResponseWriter, r *http.Request) {
+	var input taskInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
+		return
+	}
+
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = insertTask(tx, r, input, time.Now())
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".create")
+		return
+	}
+
+	w.Header().Set("Location", v2TaskPath(after.ID))
+	writeTaskV2(w, http.StatusCreated, after)
+}
+
+// getTaskV2 - GET /api/v2/tasks/{id}
+func getTaskV2(w http.ResponseWriter, r *http.Request) {
+	task, err := loadTask(r.Context(), db, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeTaskNotFound))
+		return
+	} else if err != nil {
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	writeTaskV2(w, http.StatusOK, task)
+}
+
+// replaceTaskV2 - PUT /api/v2/tasks/{id}: задача целиком, id в теле можно не указывать
+func replaceTaskV2(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var input taskInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
+		return
+	}
+	if input.ID != "" && input.ID != id {
+		writeAPIError(w, r, newFieldError(CodeIDMismatch, "id"))
+		return
+	}
+	input.ID = id
+
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = replaceTask(tx, r, input, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+	writeTaskV2(w, http.StatusOK, after)
+}
+
+// patchTaskV2 - PATCH /api/v2/tasks/{id} по правилам JSON Merge Patch, как PATCH в v1
+func patchTaskV2(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON).text(CodeInvalidJSON+".patch"))
+		return
+	}
+	if raw, ok := patch["id"]; ok {
+		var bodyID string
+		if err := json.Unmarshal(raw, &bodyID); err != nil || bodyID != id {
+			writeAPIError(w, r, newFieldError(CodeIDMismatch, "id"))
+			return
+		}
+		delete(patch, "id")
+	}
+
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = mergeTask(tx, r, id, patch, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+	writeTaskV2(w, http.StatusOK, after)
+}
+
+// deleteTaskV2 - DELETE /api/v2/tasks/{id}: 204 без тела
+func deleteTaskV2(w http.ResponseWriter, r *http.Request) {
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		return removeTask(tx, r, r.PathValue("id"), r.Header.Get("If-Match"))
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".delete")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// doneTaskV2 - POST /api/v2/tasks/{id}/done: задача после выполнения.
+// У повторяющейся задачи в ответе уже следующая дата.
+func doneTaskV2(w http.ResponseWriter, r *http.Request) {
+	var after *Task
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		var err error
+		after, err = completeTask(tx, r, r.PathValue("id"), r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".update")
+		return
+	}
+	writeTaskV2(w, http.StatusOK, after)
+}
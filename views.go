@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// View - сохранённый список: запрос q под названием, который интерфейс показывает в боковой панели
+type View struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// viewsHandler - сохранённые списки.
+// GET без id - все списки, GET ?id= - один список, POST - создать, PUT - изменить, DELETE ?id= - удалить.
+// Задачи списка отдаёт GET /api/tasks?view=<id>.
+func viewsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("id") != "" {
+			getView(w, r)
+		} else {
+			listViews(w, r)
+		}
+	case http.MethodPost, http.MethodPut:
+		saveView(w, r)
+	case http.MethodDelete:
+		deleteView(w, r)
+	default:
+		writeAPIError(w, r, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed))
+	}
+}
+
+// loadView - читает сохранённый список по ID
+func loadView(ctx context.Context, q dbtx, id string) (*View, error) {
+	var view View
+	err := q.QueryRowContext(ctx, "SELECT id, name, query FROM views WHERE id = ?", id).Scan(&view.ID, &view.Name, &view.Query)
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// listViews - все сохранённые списки в порядке создания
+func listViews(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), "SELECT id, name, query FROM views ORDER BY id")
+	if err != nil {
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	defer rows.Close()
+
+	views := []View{}
+	for rows.Next() {
+		var view View
+		if err := rows.Scan(&view.ID, &view.Name, &view.Query); err != nil {
+			writeError(w, r, err, CodeStorage+".read")
+			return
+		}
+		views = append(views, view)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, err, CodeStorage+".read")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]View{"views": views})
+}
+
+// getView - один сохранённый список
+func getView(w http.ResponseWriter, r *http.Request) {
+	view, err := loadView(r.Context(), db, r.URL.Query().Get("id"))
+	if err == sql.ErrNoRows {
+		writeAPIError(w, r, newAPIError(http.StatusNotFound, CodeViewNotFound))
+		return
+	} else if err != nil {
+		writeError(w, r, err, CodeStorage)
+		return
+	}
+	json.NewEncoder(w).Encode(view)
+}
+
+// saveView - создаёт (POST) или изменяет (PUT, id в теле) сохранённый список.
+// Запрос проверяется при сохранении, чтобы в списках не оставались запросы с ошибками.
+func saveView(w http.ResponseWriter, r *http.Request) {
+	var view View
+	if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+		writeAPIError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidJSON))
+		return
+	}
+	view.Name = strings.TrimSpace(view.Name)
+	view.Query = strings.TrimSpace(view.Query)
+	if view.Name == "" {
+		writeAPIError(w, r, newFieldError(CodeFieldRequired, "name"))
+		return
+	}
+	if view.Query == "" {
+		writeAPIError(w, r, newFieldError(CodeFieldRequired, "query"))
+		return
+	}
+	if _, err := parseTaskQuery(view.Query); err != nil {
+		writeError(w, r, err, CodeInvalidQuery)
+		return
+	}
+	if r.Method == http.MethodPut && view.ID == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		if r.Method == http.MethodPost {
+			res, err := tx.ExecContext(r.Context(), "INSERT INTO views (name, query) VALUES (?, ?)", view.Name, view.Query)
+			if err != nil {
+				return err
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			view.ID = strconv.FormatInt(id, 10)
+			return nil
+		}
+
+		res, err := tx.ExecContext(r.Context(), "UPDATE views SET name = ?, query = ? WHERE id = ?", view.Name, view.Query, view.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return newAPIError(http.StatusNotFound, CodeViewNotFound)
+		}
+		return nil
+	})
+	if isUniqueViolation(err) {
+		writeAPIError(w, r, newAPIError(http.StatusConflict, CodeViewNameTaken))
+		return
+	} else if err != nil {
+		writeError(w, r, err, CodeStorage+".view")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		json.NewEncoder(w).Encode(map[string]string{"id": view.ID})
+		return
+	}
+	json.NewEncoder(w).Encode(view)
+}
+
+// deleteView - удаляет сохранённый список, задачи не меняются
+func deleteView(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeAPIError(w, r, newFieldError(CodeIDRequired, "id"))
+		return
+	}
+
+	err := withTx(r.Context(), func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(r.Context(), "DELETE FROM views WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return newAPIError(http.StatusNotFound, CodeViewNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err, CodeStorage+".delete")
+		return
+	}
+
+	w.Write([]byte(`{}`))
+}